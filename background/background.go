@@ -0,0 +1,110 @@
+package background
+
+import (
+	mgl "github.com/go-gl/mathgl/mgl64"
+	"github.com/virus-rpi/ThreeDView/texture"
+	. "github.com/virus-rpi/ThreeDView/types"
+	"image"
+	"image/color"
+	"math"
+)
+
+// Gradient is a vertical gradient from the ground below over the horizon to the sky above
+type Gradient struct {
+	top     color.RGBA // The color straight up
+	horizon color.RGBA // The color at the horizon
+	bottom  color.RGBA // The color straight down
+}
+
+// NewGradient creates a vertical gradient background. Pass it to SetBackground of the widget or scene to use it
+func NewGradient(top, horizon, bottom color.Color) *Gradient {
+	gradient := &Gradient{}
+	gradient.SetColors(top, horizon, bottom)
+	return gradient
+}
+
+// SetColors sets the color straight up, at the horizon and straight down
+func (gradient *Gradient) SetColors(top, horizon, bottom color.Color) {
+	gradient.top = color.RGBAModel.Convert(top).(color.RGBA)
+	gradient.horizon = color.RGBAModel.Convert(horizon).(color.RGBA)
+	gradient.bottom = color.RGBAModel.Convert(bottom).(color.RGBA)
+}
+
+func (gradient *Gradient) ColorAt(direction mgl.Vec3) color.RGBA {
+	// The colors are blended by the sine of the angle above or below the horizon
+	if direction.Y() >= 0 {
+		return LerpColor(gradient.horizon, gradient.top, direction.Y())
+	}
+	return LerpColor(gradient.horizon, gradient.bottom, -direction.Y())
+}
+
+// Equirectangular is a panorama image that covers all directions, like the photo of a 360 degree camera.
+// The center of the image is in the -Z direction (where the camera looks without rotation), +X is to the right of it
+type Equirectangular struct {
+	texture *texture.Texture
+}
+
+// NewEquirectangular creates a panorama background from an image twice as wide as high
+func NewEquirectangular(img image.Image) *Equirectangular {
+	panorama := &Equirectangular{texture: newBackgroundTexture(img)}
+	panorama.texture.SetWrap(texture.WrapRepeat, texture.WrapClamp)
+	return panorama
+}
+
+func (panorama *Equirectangular) ColorAt(direction mgl.Vec3) color.RGBA {
+	u := 0.5 + math.Atan2(direction.X(), -direction.Z())/(2*math.Pi)
+	v := 0.5 + math.Asin(math.Max(-1, math.Min(1, direction.Y())))/math.Pi
+	return panorama.texture.Sample(mgl.Vec2{u, v}, 0)
+}
+
+// CubeMap is a skybox made of six square images, one for each side of a cube around the camera.
+// The images are laid out like in the common horizontal cross: the side images are upright and seen from inside the cube,
+// the bottom edge of the top image and the top edge of the bottom image touch the front image
+type CubeMap struct {
+	right, left, top, bottom, front, back *texture.Texture
+}
+
+// NewCubeMap creates a skybox from the images of the +X (right), -X (left), +Y (top), -Y (bottom), -Z (front) and +Z (back)
+// side of the cube. The front side is where the camera looks without rotation
+func NewCubeMap(right, left, top, bottom, front, back image.Image) *CubeMap {
+	cubeMap := &CubeMap{
+		right:  newBackgroundTexture(right),
+		left:   newBackgroundTexture(left),
+		top:    newBackgroundTexture(top),
+		bottom: newBackgroundTexture(bottom),
+		front:  newBackgroundTexture(front),
+		back:   newBackgroundTexture(back),
+	}
+	return cubeMap
+}
+
+func (cubeMap *CubeMap) ColorAt(direction mgl.Vec3) color.RGBA {
+	x, y, z := direction.X(), direction.Y(), direction.Z()
+	absX, absY, absZ := math.Abs(x), math.Abs(y), math.Abs(z)
+	// The axis with the largest component selects the side, the other two are the position on it from -1 to 1
+	var side *texture.Texture
+	var u, v float64
+	switch {
+	case absX >= absY && absX >= absZ && x > 0:
+		side, u, v = cubeMap.right, z/absX, y/absX
+	case absX >= absY && absX >= absZ:
+		side, u, v = cubeMap.left, -z/absX, y/absX
+	case absY >= absZ && y > 0:
+		side, u, v = cubeMap.top, x/absY, z/absY
+	case absY >= absZ:
+		side, u, v = cubeMap.bottom, x/absY, -z/absY
+	case z < 0:
+		side, u, v = cubeMap.front, x/absZ, y/absZ
+	default:
+		side, u, v = cubeMap.back, -x/absZ, y/absZ
+	}
+	return side.Sample(mgl.Vec2{(u + 1) / 2, (v + 1) / 2}, 0)
+}
+
+// newBackgroundTexture creates a bilinear filtered texture without mipmaps that is clamped to its edges
+func newBackgroundTexture(img image.Image) *texture.Texture {
+	backgroundTexture := texture.NewTexture(img)
+	backgroundTexture.SetMipmaps(false)
+	backgroundTexture.SetWrap(texture.WrapClamp, texture.WrapClamp)
+	return backgroundTexture
+}
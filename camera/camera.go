@@ -7,10 +7,17 @@ import (
 	"log"
 	"math"
 	"sync"
+	"sync/atomic"
+)
+
+const (
+	minNear          = 1e-6 // The smallest distance of the near plane
+	autoNearFarRatio = 1e6  // The largest ratio between the far and near plane when they are fitted to the scene
 )
 
 var (
 	vec4Pool     = sync.Pool{New: func() any { return make([]mgl.Vec4, 0, 16) }}
+	vec3Pool     = sync.Pool{New: func() any { return make([]mgl.Vec3, 0, 16) }}
 	vec2Pool     = sync.Pool{New: func() any { return make([]mgl.Vec2, 0, 16) }}
 	float64Pool  = sync.Pool{New: func() any { return make([]float64, 0, 64) }}
 	trianglePool = sync.Pool{New: func() any { return make([]ClippedTriangle, 0, 8) }}
@@ -25,15 +32,20 @@ type Camera struct {
 	controller Controller // Camera controller
 	widget     ThreeDWidgetInterface
 
-	needsOctreeRebuild bool
-	octree             *octreeNode // Octree for culling
-	octreeMutex        sync.RWMutex
+	depthRange  DepthRange // The depth mode and the near and far plane
+	autoNearFar bool       // Whether the near and far plane are fitted to the scene bounds on every update
+	sceneBounds *AABB      // The bounds of all faces in the octree, nil if there are none
+
+	needsOctreeRebuild atomic.Bool  // Set by RebuildOctree, which may be called from any goroutine
+	octree             *octreeNode  // Octree for culling, nil until it is built
+	octreeMutex        sync.RWMutex // Guards octree and sceneBounds. Held for reading until a query of visible faces is done
 
 	// Cached values
 	viewCache        mgl.Mat4
 	perspectiveCache mgl.Mat4
 	mvpCache         mgl.Mat4
 	frustumCache     Frustum
+	depthRangeCache  DepthRange
 	aspectRatio      float64
 	cacheMutex       sync.RWMutex
 }
@@ -54,6 +66,51 @@ func (camera *Camera) SetFov(fov Degrees) {
 	camera.fov = fov.ToRadians()
 }
 
+// DepthRange returns the depth mode and the near and far plane of the last camera update.
+// With automatic near and far planes these are the fitted planes
+func (camera *Camera) DepthRange() DepthRange {
+	camera.cacheMutex.RLock()
+	defer camera.cacheMutex.RUnlock()
+	return camera.depthRangeCache
+}
+
+// NearFar returns the distances of the near and far plane set with SetNearFar
+func (camera *Camera) NearFar() (near, far Unit) {
+	return camera.depthRange.Near, camera.depthRange.Far
+}
+
+// SetNearFar sets the distances of the near and far plane. Geometry closer than the near or further than the far plane
+// is clipped. The smaller the ratio between far and near, the more precise is the depth. far can be math.Inf(1) for no far plane.
+// This disables automatic near and far planes. Default is 0.1 and no far plane
+func (camera *Camera) SetNearFar(near, far Unit) {
+	camera.depthRange.Near = max(near, minNear)
+	camera.depthRange.Far = max(far, camera.depthRange.Near*(1+1e-6))
+	camera.autoNearFar = false
+}
+
+// AutoNearFar returns whether the near and far plane are fitted to the scene bounds
+func (camera *Camera) AutoNearFar() bool {
+	return camera.autoNearFar
+}
+
+// SetAutoNearFar sets whether the near and far plane are fitted to the bounds of all faces on every update,
+// so the depth precision is spent where the scene is. Lines, points and billboards outside the bounds of the faces are clipped.
+// Default is false
+func (camera *Camera) SetAutoNearFar(auto bool) {
+	camera.autoNearFar = auto
+}
+
+// DepthMode returns how the distance from the camera is stored in the depth buffer
+func (camera *Camera) DepthMode() DepthMode {
+	return camera.depthRange.Mode
+}
+
+// SetDepthMode sets how the distance from the camera is stored in the depth buffer. DepthReversed and DepthLogarithmic
+// keep the depth precise in scenes that span from close objects to far away terrain. Default is DepthStandard
+func (camera *Camera) SetDepthMode(mode DepthMode) {
+	camera.depthRange.Mode = mode
+}
+
 func (camera *Camera) Rotation() mgl.Quat {
 	return camera.rotation
 }
@@ -79,6 +136,11 @@ func NewCamera(position mgl.Vec3, rotation mgl.Quat, widget ThreeDWidgetInterfac
 		rotation: rotation,
 		fov:      Degrees(90).ToRadians(),
 		widget:   widget,
+		depthRange: DepthRange{
+			Mode: DepthStandard,
+			Near: DefaultNear,
+			Far:  Unit(math.Inf(1)),
+		},
 	}
 	cam.UpdateCamera() // Initialize cache
 	log.Println("initialized cam cache")
@@ -126,15 +188,21 @@ func (camera *Camera) getFrustumPlanes() Frustum {
 		D:      m[15] + m[14],
 	}
 
-	// Far plane
+	// Far plane, which is at NDC z 0 instead of 1 with reversed depth
+	farNDC := camera.depthRangeCache.FarNDC()
 	frustum.Planes[5] = Plane{
-		Normal: mgl.Vec3{m[3] - m[2], m[7] - m[6], m[11] - m[10]},
-		D:      m[15] - m[14],
+		Normal: mgl.Vec3{farNDC*m[3] - m[2], farNDC*m[7] - m[6], farNDC*m[11] - m[10]},
+		D:      farNDC*m[15] - m[14],
 	}
 
 	// Normalize all planes
 	for i := range frustum.Planes {
 		length := frustum.Planes[i].Normal.Len()
+		if length == 0 {
+			// Without a far plane the plane has no normal and culls nothing
+			frustum.Planes[i] = Plane{D: 1}
+			continue
+		}
 		frustum.Planes[i].Normal = frustum.Planes[i].Normal.Mul(1.0 / length)
 		frustum.Planes[i].D /= length
 	}
@@ -147,33 +215,63 @@ func (camera *Camera) UpdateCamera() {
 	camera.cacheMutex.Lock()
 	defer camera.cacheMutex.Unlock()
 
-	// Initialize octree if needed
-	if camera.octree == nil {
-		bounds := AABB{
-			Min: mgl.Vec3{-1000, -1000, -1000},
-			Max: mgl.Vec3{1000, 1000, 1000},
-		}
-		camera.octree = newOctree(bounds, 8, 32)
-	}
-
 	// Update cached values
 	width, height := camera.widget.GetWidth(), camera.widget.GetHeight()
 	camera.aspectRatio = float64(width) / float64(height)
 	camera.viewCache = camera.rotation.Mat4().Mul4(mgl.Translate3D(-camera.position.X(), -camera.position.Y(), -camera.position.Z()))
-	camera.perspectiveCache = mgl.Perspective(float64(camera.fov), camera.aspectRatio, 0.1, 1e30)
+	camera.depthRangeCache = camera.fitDepthRange()
+	camera.perspectiveCache = camera.depthRangeCache.Projection(camera.fov, camera.aspectRatio)
 	camera.mvpCache = camera.perspectiveCache.Mul4(camera.viewCache)
 	camera.frustumCache = camera.getFrustumPlanes()
 }
 
-// GetVisibleFaces returns faces visible in the frustum
+// fitDepthRange returns the depth range with the near and far plane moved to the closest and furthest corner of the scene bounds
+// if they are fitted automatically. If the camera is inside the bounds, the near plane is a fraction of the far plane
+func (camera *Camera) fitDepthRange() DepthRange {
+	depthRange := camera.depthRange
+	if !camera.autoNearFar {
+		return depthRange
+	}
+	camera.octreeMutex.RLock()
+	sceneBounds := camera.sceneBounds
+	camera.octreeMutex.RUnlock()
+	if sceneBounds == nil {
+		return depthRange
+	}
+	closest, furthest := math.Inf(1), math.Inf(-1)
+	for _, corner := range sceneBounds.Corners() {
+		// The camera looks along -Z in view space
+		depth := -camera.viewCache.Mul4x1(corner.Vec4(1)).Z()
+		closest = math.Min(closest, depth)
+		furthest = math.Max(furthest, depth)
+	}
+	if furthest <= 0 {
+		return depthRange
+	}
+	// A small margin keeps faces on the bounds from being clipped by rounding
+	far := furthest * 1.01
+	depthRange.Near = Unit(math.Max(math.Max(closest*0.99, far/autoNearFarRatio), float64(minNear)))
+	depthRange.Far = Unit(math.Max(far, float64(depthRange.Near)*(1+1e-6)))
+	return depthRange
+}
+
+// GetVisibleFaces returns faces visible in the frustum. The octree isn't rebuilt until all faces were received
 func (camera *Camera) GetVisibleFaces() chan FaceData {
+	camera.cacheMutex.RLock()
+	frustum := camera.frustumCache
+	camera.cacheMutex.RUnlock()
 	camera.octreeMutex.RLock()
-	defer camera.octreeMutex.RUnlock()
 	callbackChan := make(chan FaceData, 1000)
+	if camera.octree == nil {
+		camera.octreeMutex.RUnlock()
+		close(callbackChan)
+		return callbackChan
+	}
 	var wg sync.WaitGroup
 	wg.Add(1)
 	go func() {
-		camera.octree.query(camera.frustumCache, callbackChan, &wg)
+		defer camera.octreeMutex.RUnlock()
+		camera.octree.query(frustum, callbackChan, &wg)
 		wg.Wait()
 		close(callbackChan)
 	}()
@@ -196,22 +294,41 @@ func (camera *Camera) UnProject(point2d mgl.Vec2, distance Unit) mgl.Vec3 {
 	defer camera.cacheMutex.RUnlock()
 	width, height := camera.widget.GetWidth(), camera.widget.GetHeight()
 	nearPoint, _ := mgl.UnProject(mgl.Vec3{point2d.X(), float64(height) - point2d.Y(), 0.0}, camera.viewCache, camera.perspectiveCache, 0, 0, int(width), int(height))
-	farPoint, _ := mgl.UnProject(mgl.Vec3{point2d.X(), float64(height) - point2d.Y(), 1.0}, camera.viewCache, camera.perspectiveCache, 0, 0, int(width), int(height))
-	return nearPoint.Add(farPoint.Sub(nearPoint).Normalize().Mul(float64(distance)))
+	// The ray goes from the camera through the point on the near plane, the far plane can be infinitely far away
+	return nearPoint.Add(nearPoint.Sub(camera.position).Normalize().Mul(float64(distance)))
+}
+
+// ViewProjection returns the combined view and projection matrix of the last camera update.
+// It maps world space to clip space, the depth buffer stores the depth of the normalized device coordinates as defined by DepthRange
+func (camera *Camera) ViewProjection() mgl.Mat4 {
+	camera.cacheMutex.RLock()
+	defer camera.cacheMutex.RUnlock()
+	return camera.mvpCache
 }
 
 // ClipAndProjectFace clips a polygon (in world space) to the camera frustum and returns the resulting polygon(s) in screen space
-// If texCoords is provided, texture coordinates will be interpolated for the clipped polygon
+// If texCoords is provided, texture coordinates will be interpolated for the clipped polygon.
+// Every resulting vertex also gets the barycentric weights of the original face vertices so any other per-vertex attribute can be interpolated
 func (camera *Camera) ClipAndProjectFace(face FaceData, texCoords ...[3]mgl.Vec2) []ClippedTriangle {
 	camera.cacheMutex.RLock()
-	mvp := camera.mvpCache
+	mvp, depthRange := camera.mvpCache, camera.depthRangeCache
 	camera.cacheMutex.RUnlock()
 	width, height := camera.widget.GetWidth(), camera.widget.GetHeight()
+	return clipAndProjectFace(face, mvp, depthRange, width, height, texCoords...)
+}
+
+// clipAndProjectFace clips a face to the frustum of the view projection matrix and projects it onto a screen of the size.
+// The Z of the vertices are the depth buffer values of the depth range
+func clipAndProjectFace(face FaceData, mvp mgl.Mat4, depthRange DepthRange, width, height Pixel, texCoords ...[3]mgl.Vec2) []ClippedTriangle {
 
 	vertices := vec4Pool.Get().([]mgl.Vec4)[:0]
+	weights := vec3Pool.Get().([]mgl.Vec3)[:0]
 	for i := 0; i < 3; i++ {
 		v := face.Face[i]
 		vertices = append(vertices, mvp.Mul4x1(mgl.Vec4{v.X(), v.Y(), v.Z(), 1}))
+		var weight mgl.Vec3
+		weight[i] = 1
+		weights = append(weights, weight)
 	}
 
 	hasTexture := len(texCoords) > 0
@@ -220,27 +337,18 @@ func (camera *Camera) ClipAndProjectFace(face FaceData, texCoords ...[3]mgl.Vec2
 		texCoordsArray = texCoords[0]
 	}
 
-	vertexToTexCoord := map[int]mgl.Vec2{}
-	for i := 0; i < 3 && hasTexture; i++ {
-		vertexToTexCoord[i] = texCoordsArray[i]
-	}
-
-	var clippedVertices []mgl.Vec4
-	var clippedTexCoords []mgl.Vec2
-	if hasTexture {
-		clippedVertices, clippedTexCoords = clipPolygonHomogeneousWithTexCoords(vertices, vertexToTexCoord, true)
-	} else {
-		clippedVertices = clipPolygonHomogeneous(vertices)
-	}
+	clippedVertices, clippedWeights := clipPolygonHomogeneous(vertices, weights, depthRange.FarNDC())
 
 	vec4Pool.Put(vertices)
+	vec3Pool.Put(weights)
 	if len(clippedVertices) < 3 {
 		return nil
 	}
 
 	out2d := vec2Pool.Get().([]mgl.Vec2)[:0]
 	outz := float64Pool.Get().([]float64)[:0]
-	outtex := vec2Pool.Get().([]mgl.Vec2)[:0]
+	outw := float64Pool.Get().([]float64)[:0]
+	outWeights := vec3Pool.Get().([]mgl.Vec3)[:0]
 	for i, v := range clippedVertices {
 		if v.W() <= 0 {
 			continue
@@ -249,15 +357,15 @@ func (camera *Camera) ClipAndProjectFace(face FaceData, texCoords ...[3]mgl.Vec2
 		sx := (ndc.X() + 1) * 0.5 * float64(width)
 		sy := (1 - (ndc.Y()+1)*0.5) * float64(height)
 		out2d = append(out2d, mgl.Vec2{sx, sy})
-		outz = append(outz, ndc.Z())
-		if hasTexture {
-			outtex = append(outtex, clippedTexCoords[i])
-		}
+		outz = append(outz, depthRange.Depth(ndc.Z(), v.W()))
+		outw = append(outw, v.W())
+		outWeights = append(outWeights, clippedWeights[i])
 	}
 	if len(out2d) < 3 {
 		vec2Pool.Put(out2d)
 		float64Pool.Put(outz)
-		vec2Pool.Put(outtex)
+		float64Pool.Put(outw)
+		vec3Pool.Put(outWeights)
 		return nil
 	}
 
@@ -274,157 +382,169 @@ func (camera *Camera) ClipAndProjectFace(face FaceData, texCoords ...[3]mgl.Vec2
 
 	result := trianglePool.Get().([]ClippedTriangle)[:0]
 	for i := 0; i+2 < len(indices); i += 3 {
-		tri := [3]mgl.Vec2{
-			out2d[indices[i]],
-			out2d[indices[i+1]],
-			out2d[indices[i+2]],
-		}
-		ztri := [3]float64{
-			outz[indices[i]],
-			outz[indices[i+1]],
-			outz[indices[i+2]],
-		}
-		var textri [3]mgl.Vec2
-		if hasTexture {
-			textri = [3]mgl.Vec2{
-				outtex[indices[i]],
-				outtex[indices[i+1]],
-				outtex[indices[i+2]],
+		var triangle ClippedTriangle
+		for j := 0; j < 3; j++ {
+			index := indices[i+j]
+			triangle.Points[j] = out2d[index]
+			triangle.Z[j] = outz[index]
+			triangle.W[j] = outw[index]
+			triangle.Barycentric[j] = outWeights[index]
+			if hasTexture {
+				triangle.TexCoords[j] = interpolateVec2(texCoordsArray, outWeights[index])
 			}
 		}
-		result = append(result, ClippedTriangle{Points: tri, Z: ztri, TexCoords: textri, HasTexture: hasTexture})
+		triangle.HasTexture = hasTexture
+		result = append(result, triangle)
 	}
 
 	vec2Pool.Put(out2d)
 	float64Pool.Put(outz)
-	vec2Pool.Put(outtex)
+	float64Pool.Put(outw)
+	vec3Pool.Put(outWeights)
 	float64Pool.Put(flat)
 	indexPool.Put(indices)
 
 	return result
 }
 
-// clipPolygonHomogeneous clips a convex polygon in homogeneous clip space against the canonical view frustum
-func clipPolygonHomogeneous(vertices []mgl.Vec4) []mgl.Vec4 {
-	planes := [][4]float64{
-		{1, 0, 0, 1},  // x <= w
-		{-1, 0, 0, 1}, // -x <= w
-		{0, 1, 0, 1},  // y <= w
-		{0, -1, 0, 1}, // -y <= w
-		{0, 0, 1, 1},  // z <= w
-		{0, 0, -1, 1}, // -z <= w
-	}
-	out := vertices
+// ClipAndProjectLine clips a line segment (in world space) to the camera frustum and projects it to screen space.
+// Returns false if no part of the segment is inside the frustum
+func (camera *Camera) ClipAndProjectLine(start, end mgl.Vec3) (ClippedLine, bool) {
+	camera.cacheMutex.RLock()
+	mvp, depthRange := camera.mvpCache, camera.depthRangeCache
+	camera.cacheMutex.RUnlock()
+	width, height := camera.widget.GetWidth(), camera.widget.GetHeight()
+
+	a, b := mvp.Mul4x1(start.Vec4(1)), mvp.Mul4x1(end.Vec4(1))
+	// Every frustum plane cuts away the part of the segment outside it (Liang-Barsky in homogeneous clip space)
+	t0, t1 := 0.0, 1.0
+	planes := [][4]float64{{1, 0, 0, 1}, {-1, 0, 0, 1}, {0, 1, 0, 1}, {0, -1, 0, 1}, {0, 0, 1, 1}, {0, 0, -1, depthRange.FarNDC()}}
 	for _, p := range planes {
-		var clipped []mgl.Vec4
-		for i := 0; i < len(out); i++ {
-			j := (i + 1) % len(out)
-			a := out[i]
-			b := out[j]
-			ad := p[0]*a.X() + p[1]*a.Y() + p[2]*a.Z() + p[3]*a.W()
-			bd := p[0]*b.X() + p[1]*b.Y() + p[2]*b.Z() + p[3]*b.W()
-			if ad >= 0 {
-				clipped = append(clipped, a)
-			}
-			if (ad >= 0) != (bd >= 0) {
-				t := ad / (ad - bd)
-				iv := a.Add(b.Sub(a).Mul(t))
-				clipped = append(clipped, iv)
-			}
+		ad := p[0]*a.X() + p[1]*a.Y() + p[2]*a.Z() + p[3]*a.W()
+		bd := p[0]*b.X() + p[1]*b.Y() + p[2]*b.Z() + p[3]*b.W()
+		switch {
+		case ad < 0 && bd < 0:
+			return ClippedLine{}, false
+		case ad < 0:
+			t0 = max(t0, ad/(ad-bd))
+		case bd < 0:
+			t1 = min(t1, ad/(ad-bd))
 		}
-		out = clipped
-		if len(out) == 0 {
-			return nil
+	}
+	if t0 > t1 {
+		return ClippedLine{}, false
+	}
+
+	var line ClippedLine
+	for i, t := range [2]float64{t0, t1} {
+		v := a.Add(b.Sub(a).Mul(t))
+		if v.W() <= 0 {
+			return ClippedLine{}, false
 		}
+		ndc := v.Mul(1.0 / v.W())
+		line.Points[i] = mgl.Vec2{(ndc.X() + 1) * 0.5 * float64(width), (1 - (ndc.Y()+1)*0.5) * float64(height)}
+		line.Z[i] = depthRange.Depth(ndc.Z(), v.W())
+		line.W[i] = v.W()
+		line.T[i] = t
 	}
-	return out
+	return line, true
 }
 
-// clipPolygonHomogeneousWithTexCoords clips a convex polygon in homogeneous clip space against the canonical view frustum
-// and interpolates texture coordinates for any new vertices created during clipping
-func clipPolygonHomogeneousWithTexCoords(vertices []mgl.Vec4, texCoords map[int]mgl.Vec2, hasTexture bool) ([]mgl.Vec4, []mgl.Vec2) {
-	if !hasTexture {
-		return clipPolygonHomogeneous(vertices), nil
-	}
+// interpolateVec2 interpolates three values with barycentric weights
+func interpolateVec2(values [3]mgl.Vec2, weights mgl.Vec3) mgl.Vec2 {
+	return values[0].Mul(weights[0]).Add(values[1].Mul(weights[1])).Add(values[2].Mul(weights[2]))
+}
 
+// clipPolygonHomogeneous clips a convex polygon in homogeneous clip space against the canonical view frustum with the far plane
+// at the NDC z farNDC and interpolates the barycentric weights for any new vertices created during clipping
+func clipPolygonHomogeneous(vertices []mgl.Vec4, weights []mgl.Vec3, farNDC float64) ([]mgl.Vec4, []mgl.Vec3) {
 	planes := [][4]float64{
-		{1, 0, 0, 1},  // x <= w
-		{-1, 0, 0, 1}, // -x <= w
-		{0, 1, 0, 1},  // y <= w
-		{0, -1, 0, 1}, // -y <= w
-		{0, 0, 1, 1},  // z <= w
-		{0, 0, -1, 1}, // -z <= w
+		{1, 0, 0, 1},       // x <= w
+		{-1, 0, 0, 1},      // -x <= w
+		{0, 1, 0, 1},       // y <= w
+		{0, -1, 0, 1},      // -y <= w
+		{0, 0, 1, 1},       // -z <= w
+		{0, 0, -1, farNDC}, // z <= farNDC * w
 	}
 
 	outVertices := vertices
-	outTexCoords := make([]mgl.Vec2, len(vertices))
-	for i := 0; i < len(vertices); i++ {
-		outTexCoords[i] = texCoords[i]
-	}
+	outWeights := weights
 
 	for _, p := range planes {
 		var clippedVertices []mgl.Vec4
-		var clippedTexCoords []mgl.Vec2
+		var clippedWeights []mgl.Vec3
 
 		for i := 0; i < len(outVertices); i++ {
 			j := (i + 1) % len(outVertices)
 			a := outVertices[i]
 			b := outVertices[j]
-			ta := outTexCoords[i]
-			tb := outTexCoords[j]
 
 			ad := p[0]*a.X() + p[1]*a.Y() + p[2]*a.Z() + p[3]*a.W()
 			bd := p[0]*b.X() + p[1]*b.Y() + p[2]*b.Z() + p[3]*b.W()
 
 			if ad >= 0 {
 				clippedVertices = append(clippedVertices, a)
-				clippedTexCoords = append(clippedTexCoords, ta)
+				clippedWeights = append(clippedWeights, outWeights[i])
 			}
 
 			if (ad >= 0) != (bd >= 0) {
-				t := ad / (ad - bd)
-				iv := a.Add(b.Sub(a).Mul(t))
-
-				// Interpolate texture coordinates
-				itex := mgl.Vec2{
-					ta.X() + t*(tb.X()-ta.X()),
-					ta.Y() + t*(tb.Y()-ta.Y()),
+				// Always interpolate from the inside vertex so faces sharing this edge get exactly the same new vertex
+				in, out, inWeight, outWeight, inD, outD := a, b, outWeights[i], outWeights[j], ad, bd
+				if bd >= 0 {
+					in, out, inWeight, outWeight, inD, outD = b, a, outWeights[j], outWeights[i], bd, ad
 				}
-
-				clippedVertices = append(clippedVertices, iv)
-				clippedTexCoords = append(clippedTexCoords, itex)
+				t := inD / (inD - outD)
+				clippedVertices = append(clippedVertices, in.Add(out.Sub(in).Mul(t)))
+				clippedWeights = append(clippedWeights, inWeight.Add(outWeight.Sub(inWeight).Mul(t)))
 			}
 		}
 
 		outVertices = clippedVertices
-		outTexCoords = clippedTexCoords
+		outWeights = clippedWeights
 
 		if len(outVertices) == 0 {
 			return nil, nil
 		}
 	}
 
-	return outVertices, outTexCoords
+	return outVertices, outWeights
 }
 
+// ForEachSceneFace calls the callback with every face in the octree, which are the faces of all objects in world space
+// as they were when the octree was built last, and returns their bounds. The bounds are nil if there are no faces.
+// The octree isn't rebuilt until all faces were passed to the callback
+func (camera *Camera) ForEachSceneFace(callback func(face FaceData)) *AABB {
+	camera.octreeMutex.RLock()
+	defer camera.octreeMutex.RUnlock()
+	if camera.octree != nil {
+		camera.octree.forEach(callback)
+	}
+	return camera.sceneBounds
+}
+
+// RebuildOctree marks the octree as outdated, so it is rebuilt by the next call of BuildOctree
 func (camera *Camera) RebuildOctree() {
-	camera.needsOctreeRebuild = true
+	camera.needsOctreeRebuild.Store(true)
 }
 
+// BuildOctree rebuilds the octree from the faces of all objects if it is outdated.
+// It is safe to call from multiple goroutines, for example from the render and the tick loop
 func (camera *Camera) BuildOctree() {
-	if !camera.needsOctreeRebuild && camera.octree != nil {
+	camera.octreeMutex.Lock()
+	defer camera.octreeMutex.Unlock()
+	// Changes while the octree is built mark it as outdated again
+	if !camera.needsOctreeRebuild.Swap(false) && camera.octree != nil {
 		return
 	}
 	log.Println("Building")
 
-	camera.octreeMutex.Lock()
-	defer camera.octreeMutex.Unlock()
 	// Clear existing octree
 	bounds := AABB{
 		Min: mgl.Vec3{-math.MaxInt, -math.MaxInt, -math.MaxInt},
 		Max: mgl.Vec3{math.MaxInt, math.MaxInt, math.MaxInt},
 	}
 	camera.octree = newOctree(bounds, 8, 32)
+	camera.sceneBounds = nil
 
 	// Get all objects from widget
 	objects := camera.widget.GetObjects()
@@ -434,16 +554,35 @@ func (camera *Camera) BuildOctree() {
 	}
 
 	var wg sync.WaitGroup
+	var boundsMutex sync.Mutex
 	wg.Add(len(objects))
 
 	for _, obj := range objects {
 		go func(obj ObjectInterface) {
 			defer wg.Done()
+			objectBounds := AABB{Min: mgl.Vec3{math.Inf(1), math.Inf(1), math.Inf(1)}, Max: mgl.Vec3{math.Inf(-1), math.Inf(-1), math.Inf(-1)}}
+			hasFaces := false
 			for face := range obj.StreamFaces() {
+				face.Object = obj
 				camera.octree.insert(face)
+				for _, vertex := range face.Face {
+					objectBounds.Extend(vertex)
+				}
+				hasFaces = true
+			}
+			if !hasFaces {
+				return
+			}
+			// The scene bounds are used to fit the near and far plane
+			boundsMutex.Lock()
+			defer boundsMutex.Unlock()
+			if camera.sceneBounds == nil {
+				camera.sceneBounds = &objectBounds
+				return
 			}
+			camera.sceneBounds.Extend(objectBounds.Min)
+			camera.sceneBounds.Extend(objectBounds.Max)
 		}(obj)
 	}
 	wg.Wait()
-	camera.needsOctreeRebuild = false
 }
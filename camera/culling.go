@@ -128,6 +128,22 @@ func (n *octreeNode) query(frustum Frustum, callbackChan chan types.FaceData, wg
 	}
 }
 
+// forEach calls the callback with every face in the node and its children
+func (n *octreeNode) forEach(callback func(face types.FaceData)) {
+	n.RLock()
+	defer n.RUnlock()
+
+	for _, face := range n.Faces {
+		callback(face)
+	}
+
+	if n.Children[0] != nil {
+		for _, child := range n.Children {
+			child.forEach(callback)
+		}
+	}
+}
+
 type Frustum struct {
 	Planes [6]Plane
 }
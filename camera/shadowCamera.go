@@ -0,0 +1,30 @@
+package camera
+
+import (
+	mgl "github.com/go-gl/mathgl/mgl64"
+	. "github.com/virus-rpi/ThreeDView/types"
+)
+
+// ShadowCamera projects faces from the point of view of a light into a square shadow map
+type ShadowCamera struct {
+	viewProjection mgl.Mat4 // Maps world space to the clip space of the shadow map
+	size           Pixel    // The width and height of the shadow map
+}
+
+// NewShadowCamera creates a camera for a shadow map of the given size with the view projection matrix of a light
+func NewShadowCamera(viewProjection mgl.Mat4, size Pixel) *ShadowCamera {
+	return &ShadowCamera{viewProjection: viewProjection, size: size}
+}
+
+func (camera *ShadowCamera) ViewProjection() mgl.Mat4 {
+	return camera.viewProjection
+}
+
+func (camera *ShadowCamera) Size() Pixel {
+	return camera.size
+}
+
+// ClipAndProjectFace clips a polygon (in world space) to the frustum of the light and returns the resulting polygon(s) in shadow map space
+func (camera *ShadowCamera) ClipAndProjectFace(face FaceData, texCoords ...[3]mgl.Vec2) []ClippedTriangle {
+	return clipAndProjectFace(face, camera.viewProjection, DepthRange{}, camera.size, camera.size, texCoords...)
+}
@@ -9,7 +9,9 @@ import (
 	mgl "github.com/go-gl/mathgl/mgl64"
 	"github.com/virus-rpi/ThreeDView"
 	"github.com/virus-rpi/ThreeDView/camera"
+	"github.com/virus-rpi/ThreeDView/light"
 	"github.com/virus-rpi/ThreeDView/object"
+	"github.com/virus-rpi/ThreeDView/types"
 	"image/color"
 	"log"
 )
@@ -32,6 +34,8 @@ func main() {
 	center, _ := object.NewObjectFromObjFile("./example/assets/stress-boat.obj", mgl.Vec3{0, 100, 0}, mgl.QuatIdent(), 100, color.RGBA{R: 255, B: 255, A: 255}, "./example/assets/stress-boat-texture.jpg", threeDEnv)
 	log.Println("Loaded object")
 
+	sun := light.NewDirectionalLight(mgl.Vec3{-1, -1, -1}, color.White, 0.9, threeDEnv)
+
 	// manualController := camera.NewManualController()
 	// manualController.ShowControlWindow()
 	// envCamera.SetController(manualController)
@@ -58,6 +62,15 @@ func main() {
 	})
 	faceOutlineCheck.SetChecked(false)
 
+	wireframeCheck := widget.NewCheck("Show Hidden Line Wireframe", func(checked bool) {
+		wireframe := types.NewWireframeSettings()
+		wireframe.Enabled = checked
+		wireframe.CreaseAngle = 30
+		wireframe.ShowHidden = true
+		threeDEnv.SetWireframe(wireframe)
+	})
+	wireframeCheck.SetChecked(false)
+
 	faceColorCheck := widget.NewCheck("Show Face Colors", func(checked bool) {
 		threeDEnv.SetRenderFaceColors(checked)
 	})
@@ -73,14 +86,40 @@ func main() {
 	})
 	shadingCheck.SetChecked(true)
 
+	lightingCheck := widget.NewCheck("Use Lighting", func(checked bool) {
+		threeDEnv.SetRenderLighting(checked)
+	})
+	lightingCheck.SetChecked(true)
+
+	shadowCheck := widget.NewCheck("Cast Shadows", func(checked bool) {
+		sun.SetCastShadows(checked)
+	})
+	shadowCheck.SetChecked(false)
+
+	antiAliasingSelect := widget.NewSelect([]string{"No Anti-Aliasing", "FXAA", "Supersampling"}, func(selected string) {
+		switch selected {
+		case "FXAA":
+			threeDEnv.SetAntiAliasing(types.AntiAliasingFXAA)
+		case "Supersampling":
+			threeDEnv.SetAntiAliasing(types.AntiAliasingSupersampling)
+		default:
+			threeDEnv.SetAntiAliasing(types.AntiAliasingNone)
+		}
+	})
+	antiAliasingSelect.SetSelected("No Anti-Aliasing")
+
 	controls := container.New(
 		layout.NewVBoxLayout(),
 		zBufferCheck,
 		edgeCheck,
 		faceOutlineCheck,
+		wireframeCheck,
 		faceColorCheck,
 		textureCheck,
 		shadingCheck,
+		lightingCheck,
+		shadowCheck,
+		antiAliasingSelect,
 	)
 	controlWindow.SetContent(controls)
 	controlWindow.Show()
@@ -6,6 +6,7 @@ require (
 	fyne.io/fyne/v2 v2.6.3
 	github.com/flywave/go-earcut v0.0.0-20210712015426-7084f78cceb3
 	github.com/go-gl/mathgl v1.2.0
+	golang.org/x/image v0.30.0
 )
 
 require (
@@ -36,7 +37,6 @@ require (
 	github.com/srwiley/rasterx v0.0.0-20220730225603-2ab79fcdd4ef // indirect
 	github.com/stretchr/testify v1.11.1 // indirect
 	github.com/yuin/goldmark v1.7.13 // indirect
-	golang.org/x/image v0.30.0 // indirect
 	golang.org/x/net v0.43.0 // indirect
 	golang.org/x/sys v0.35.0 // indirect
 	golang.org/x/text v0.28.0 // indirect
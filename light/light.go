@@ -0,0 +1,218 @@
+package light
+
+import (
+	mgl "github.com/go-gl/mathgl/mgl64"
+	. "github.com/virus-rpi/ThreeDView/types"
+	"image/color"
+	"math"
+)
+
+// Attenuation describes how the light intensity falls off with the distance d: 1 / (Constant + Linear*d + Quadratic*d²)
+type Attenuation struct {
+	Constant  float64
+	Linear    float64
+	Quadratic float64
+}
+
+// factor returns the attenuation factor at the given distance
+func (attenuation Attenuation) factor(distance float64) float64 {
+	denominator := attenuation.Constant + attenuation.Linear*distance + attenuation.Quadratic*distance*distance
+	if denominator <= 0 {
+		return 1
+	}
+	return 1 / denominator
+}
+
+// baseLight contains the properties shared by all light types
+type baseLight struct {
+	color     color.Color // The color of the light
+	intensity float64     // The intensity the color is multiplied with
+}
+
+func (light *baseLight) Color() color.Color {
+	return light.color
+}
+
+func (light *baseLight) SetColor(color color.Color) {
+	light.color = color
+}
+
+func (light *baseLight) Intensity() float64 {
+	return light.intensity
+}
+
+func (light *baseLight) SetIntensity(intensity float64) {
+	light.intensity = intensity
+}
+
+func (light *baseLight) radiance() mgl.Vec3 {
+	return ColorToVec3(light.color).Mul(light.intensity)
+}
+
+// DirectionalLight is a light infinitely far away that shines in one direction, like the sun
+type DirectionalLight struct {
+	baseLight
+	shadowCaster
+	direction mgl.Vec3 // The normalized direction the light travels in
+}
+
+// NewDirectionalLight creates a directional light shining in the given direction and adds it to the widget
+func NewDirectionalLight(direction mgl.Vec3, color color.Color, intensity float64, w ThreeDWidgetInterface) *DirectionalLight {
+	light := &DirectionalLight{
+		baseLight:    baseLight{color: color, intensity: intensity},
+		shadowCaster: shadowCaster{shadows: NewShadowSettings()},
+		direction:    direction.Normalize(),
+	}
+	w.AddLight(light)
+	return light
+}
+
+func (light *DirectionalLight) Direction() mgl.Vec3 {
+	return light.direction
+}
+
+func (light *DirectionalLight) SetDirection(direction mgl.Vec3) {
+	light.direction = direction.Normalize()
+}
+
+func (light *DirectionalLight) Illuminate(_ mgl.Vec3) (mgl.Vec3, mgl.Vec3) {
+	return light.direction.Mul(-1), light.radiance()
+}
+
+// ShadowViewProjection returns an orthographic projection along the light direction that tightly covers the bounds
+func (light *DirectionalLight) ShadowViewProjection(bounds AABB) (mgl.Mat4, bool) {
+	view := lookAt(bounds.Center(), light.direction)
+	minimum := mgl.Vec3{math.Inf(1), math.Inf(1), math.Inf(1)}
+	maximum := mgl.Vec3{math.Inf(-1), math.Inf(-1), math.Inf(-1)}
+	for _, corner := range bounds.Corners() {
+		viewCorner := mgl.TransformCoordinate(corner, view)
+		for axis := 0; axis < 3; axis++ {
+			minimum[axis] = math.Min(minimum[axis], viewCorner[axis])
+			maximum[axis] = math.Max(maximum[axis], viewCorner[axis])
+		}
+	}
+	if minimum[0] >= maximum[0] || minimum[1] >= maximum[1] {
+		return mgl.Mat4{}, false
+	}
+	// The view looks along -Z, a small margin keeps faces on the bounds from being clipped
+	margin := maximum.Sub(minimum).Len() * 0.01
+	projection := mgl.Ortho(minimum[0]-margin, maximum[0]+margin, minimum[1]-margin, maximum[1]+margin, -maximum[2]-margin, -minimum[2]+margin)
+	return projection.Mul4(view), true
+}
+
+// PointLight is a light that shines in all directions from a position
+type PointLight struct {
+	baseLight
+	position    mgl.Vec3    // The position of the light in world space
+	attenuation Attenuation // How the light falls off with distance
+}
+
+// NewPointLight creates a point light at the given position without distance falloff and adds it to the widget
+func NewPointLight(position mgl.Vec3, color color.Color, intensity float64, w ThreeDWidgetInterface) *PointLight {
+	light := &PointLight{
+		baseLight:   baseLight{color: color, intensity: intensity},
+		position:    position,
+		attenuation: Attenuation{Constant: 1},
+	}
+	w.AddLight(light)
+	return light
+}
+
+func (light *PointLight) Position() mgl.Vec3 {
+	return light.position
+}
+
+func (light *PointLight) SetPosition(position mgl.Vec3) {
+	light.position = position
+}
+
+func (light *PointLight) Attenuation() Attenuation {
+	return light.attenuation
+}
+
+func (light *PointLight) SetAttenuation(attenuation Attenuation) {
+	light.attenuation = attenuation
+}
+
+func (light *PointLight) Illuminate(point mgl.Vec3) (mgl.Vec3, mgl.Vec3) {
+	toLight := light.position.Sub(point)
+	distance := toLight.Len()
+	if distance == 0 {
+		return mgl.Vec3{}, mgl.Vec3{}
+	}
+	return toLight.Mul(1 / distance), light.radiance().Mul(light.attenuation.factor(distance))
+}
+
+// SpotLight is a point light that only shines inside a cone
+type SpotLight struct {
+	PointLight
+	shadowCaster
+	direction  mgl.Vec3 // The normalized direction the cone points in
+	innerAngle Radians  // Half angle of the cone with full intensity
+	outerAngle Radians  // Half angle of the cone after which the light is completely faded out
+}
+
+// NewSpotLight creates a spot light at the given position pointing in the given direction and adds it to the widget.
+// Inside innerAngle the light has full intensity and fades out until outerAngle (both are half angles of the cone)
+func NewSpotLight(position, direction mgl.Vec3, color color.Color, intensity float64, innerAngle, outerAngle Degrees, w ThreeDWidgetInterface) *SpotLight {
+	light := &SpotLight{
+		PointLight: PointLight{
+			baseLight:   baseLight{color: color, intensity: intensity},
+			position:    position,
+			attenuation: Attenuation{Constant: 1},
+		},
+		shadowCaster: shadowCaster{shadows: NewShadowSettings()},
+		direction:    direction.Normalize(),
+		innerAngle:   innerAngle.ToRadians(),
+		outerAngle:   outerAngle.ToRadians(),
+	}
+	w.AddLight(light)
+	return light
+}
+
+func (light *SpotLight) Direction() mgl.Vec3 {
+	return light.direction
+}
+
+func (light *SpotLight) SetDirection(direction mgl.Vec3) {
+	light.direction = direction.Normalize()
+}
+
+// SetAngles sets the inner and outer half angle of the cone
+func (light *SpotLight) SetAngles(innerAngle, outerAngle Degrees) {
+	light.innerAngle = innerAngle.ToRadians()
+	light.outerAngle = outerAngle.ToRadians()
+}
+
+func (light *SpotLight) Illuminate(point mgl.Vec3) (mgl.Vec3, mgl.Vec3) {
+	direction, radiance := light.PointLight.Illuminate(point)
+	cosAngle := direction.Mul(-1).Dot(light.direction)
+	cosInner := math.Cos(float64(light.innerAngle))
+	cosOuter := math.Cos(float64(light.outerAngle))
+	var cone float64
+	switch {
+	case cosAngle >= cosInner:
+		cone = 1
+	case cosAngle <= cosOuter || cosInner == cosOuter:
+		cone = 0
+	default:
+		t := (cosAngle - cosOuter) / (cosInner - cosOuter)
+		cone = t * t * (3 - 2*t)
+	}
+	return direction, radiance.Mul(cone)
+}
+
+// ShadowViewProjection returns a perspective projection from the light position that covers the cone up to the furthest corner of the bounds
+func (light *SpotLight) ShadowViewProjection(bounds AABB) (mgl.Mat4, bool) {
+	far := 0.0
+	for _, corner := range bounds.Corners() {
+		far = math.Max(far, corner.Sub(light.position).Len())
+	}
+	if far == 0 {
+		return mgl.Mat4{}, false
+	}
+	// Perspective projections can't cover 180 degrees, wider cones only cast shadows in their center
+	fov := math.Min(2*float64(light.outerAngle), float64(Degrees(170).ToRadians()))
+	projection := mgl.Perspective(fov, 1, far*1e-3, far*1.01)
+	return projection.Mul4(lookAt(light.position, light.direction)), true
+}
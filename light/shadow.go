@@ -0,0 +1,35 @@
+package light
+
+import (
+	mgl "github.com/go-gl/mathgl/mgl64"
+	. "github.com/virus-rpi/ThreeDView/types"
+	"math"
+)
+
+// shadowCaster contains the shadow settings shared by all lights that can cast shadows
+type shadowCaster struct {
+	shadows ShadowSettings // How the shadow map of the light is rendered and sampled
+}
+
+func (caster *shadowCaster) ShadowSettings() ShadowSettings {
+	return caster.shadows
+}
+
+// SetShadowSettings sets how the shadow map of the light is rendered and sampled. Default is NewShadowSettings
+func (caster *shadowCaster) SetShadowSettings(settings ShadowSettings) {
+	caster.shadows = settings
+}
+
+// SetCastShadows sets whether the light casts shadows. Default is false
+func (caster *shadowCaster) SetCastShadows(castShadows bool) {
+	caster.shadows.Enabled = castShadows
+}
+
+// lookAt returns the view matrix of a light at the position looking in the direction
+func lookAt(position, direction mgl.Vec3) mgl.Mat4 {
+	up := mgl.Vec3{0, 1, 0}
+	if math.Abs(direction.Normalize().Y()) > 0.99 {
+		up = mgl.Vec3{0, 0, 1}
+	}
+	return mgl.LookAtV(position, position.Add(direction), up)
+}
@@ -0,0 +1,227 @@
+package object
+
+import (
+	mgl "github.com/go-gl/mathgl/mgl64"
+	"github.com/virus-rpi/ThreeDView/texture"
+	. "github.com/virus-rpi/ThreeDView/types"
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/gofont/goregular"
+	"golang.org/x/image/font/opentype"
+	"golang.org/x/image/math/fixed"
+	"image"
+	"image/color"
+	"image/draw"
+	"math"
+	"strings"
+	"sync"
+)
+
+// Billboard is an image that always faces the camera, for example a sprite or an icon marking a position.
+// It is drawn over the rendered scene, so it isn't shaded, fogged or outlined
+type Billboard struct {
+	Object
+	image       *texture.Texture
+	size        float64         // The height in pixels or world units, 0 for the size of the image in pixels
+	sizeMode    WidthMode       // Whether the size is in pixels or world units
+	anchor      ObjectInterface // The object the billboard follows, nil for none
+	offset      mgl.Vec2        // The distance in pixels from the projected position to the pivot, +Y is down
+	pivot       mgl.Vec2        // The point of the image placed at the offset, from (0, 0) top left to (1, 1) bottom right
+	depthTest   bool            // Whether faces in front of the position hide the billboard
+	leaderColor color.Color     // The color of the line from the position to the offset image, nil for none
+}
+
+func newBillboard(position mgl.Vec3, w ThreeDWidgetInterface) Billboard {
+	return Billboard{
+		Object: Object{
+			position: position,
+			rotation: mgl.QuatIdent(),
+			widget:   w,
+			material: NewMaterial(),
+		},
+		pivot:     mgl.Vec2{0.5, 0.5},
+		depthTest: true,
+	}
+}
+
+// NewBillboard creates a billboard centered at the position in world space and adds it to the widget.
+// size is the height of the image in pixels or world units, 0 draws the image with its own size
+func NewBillboard(img image.Image, position mgl.Vec3, size float64, sizeMode WidthMode, w ThreeDWidgetInterface) *Billboard {
+	billboard := newBillboard(position, w)
+	billboard.SetImage(img)
+	billboard.SetSize(size, sizeMode)
+	w.AddObject(&billboard)
+	return &billboard
+}
+
+// SetImage replaces the image of the billboard
+func (billboard *Billboard) SetImage(img image.Image) {
+	billboard.image = texture.NewTexture(img)
+	billboard.image.SetWrap(texture.WrapClamp, texture.WrapClamp)
+}
+
+// SetSize sets the height of the billboard in pixels or world units. The width follows the aspect ratio of the image.
+// 0 draws the image with its own size in pixels
+func (billboard *Billboard) SetSize(size float64, sizeMode WidthMode) {
+	billboard.size = size
+	billboard.sizeMode = sizeMode
+}
+
+// AttachTo makes the billboard follow an object. The position of the billboard becomes relative to the position
+// and rotation of the object. nil detaches it, so the position is in world space again
+func (billboard *Billboard) AttachTo(object ObjectInterface) {
+	billboard.anchor = object
+}
+
+// SetOffset moves the image by an offset in pixels away from its position on the screen, +Y is down
+func (billboard *Billboard) SetOffset(offset mgl.Vec2) {
+	billboard.offset = offset
+}
+
+// SetPivot sets the point of the image that is placed at the position plus the offset,
+// from (0, 0) at the top left to (1, 1) at the bottom right corner of the image
+func (billboard *Billboard) SetPivot(pivot mgl.Vec2) {
+	billboard.pivot = pivot
+}
+
+// SetDepthTest sets whether faces in front of the position of the billboard hide it
+func (billboard *Billboard) SetDepthTest(depthTest bool) {
+	billboard.depthTest = depthTest
+}
+
+// SetLeaderLine sets the color of a line from the position to the offset image, nil for no line
+func (billboard *Billboard) SetLeaderLine(color color.Color) {
+	billboard.leaderColor = color
+}
+
+// WorldPosition returns the position of the billboard in world space, following the object it is attached to
+func (billboard *Billboard) WorldPosition() mgl.Vec3 {
+	if billboard.anchor == nil {
+		return billboard.position
+	}
+	return billboard.anchor.Rotation().Rotate(billboard.position).Add(billboard.anchor.Position())
+}
+
+func (billboard *Billboard) Billboards() []BillboardData {
+	if billboard.image == nil {
+		return nil
+	}
+	return []BillboardData{{
+		Image:       billboard.image,
+		Position:    billboard.WorldPosition(),
+		Size:        billboard.size,
+		SizeMode:    billboard.sizeMode,
+		Offset:      billboard.offset,
+		Pivot:       billboard.pivot,
+		DepthTest:   billboard.depthTest,
+		LeaderColor: billboard.leaderColor,
+	}}
+}
+
+// Label is a text that always faces the camera, for example to name a point or an object.
+// The text is rendered with the Go font unless another font is set
+type Label struct {
+	Billboard
+	text       string
+	font       *opentype.Font
+	fontSize   float64     // The font size in pixels
+	color      color.Color // The color of the text
+	background color.Color // The color of the box behind the text, nil for none
+	padding    int         // The space in pixels between the text and the edge of the box
+}
+
+var (
+	goRegular     *opentype.Font
+	goRegularOnce sync.Once
+)
+
+// NewLabel creates a label with the text in white at the position in world space and adds it to the widget.
+// The text is drawn above the position with its own size in pixels and isn't hidden by faces
+func NewLabel(text string, position mgl.Vec3, w ThreeDWidgetInterface) *Label {
+	label := &Label{
+		Billboard: newBillboard(position, w),
+		text:      text,
+		fontSize:  14,
+		color:     color.White,
+		padding:   2,
+	}
+	label.pivot = mgl.Vec2{0.5, 1}
+	label.depthTest = false
+	label.renderText()
+	w.AddObject(label)
+	return label
+}
+
+// Text returns the text of the label
+func (label *Label) Text() string {
+	return label.text
+}
+
+// SetText sets the text of the label. Lines are separated by \n
+func (label *Label) SetText(text string) {
+	label.text = text
+	label.renderText()
+}
+
+// SetFont sets the font of the text, nil for the Go font. Fonts can be parsed from TrueType or OpenType files with opentype.Parse
+func (label *Label) SetFont(font *opentype.Font) {
+	label.font = font
+	label.renderText()
+}
+
+// SetFontSize sets the size of the font in pixels. With a size in world units the text is scaled from this size
+func (label *Label) SetFontSize(size float64) {
+	label.fontSize = size
+	label.renderText()
+}
+
+// SetColor sets the color of the text
+func (label *Label) SetColor(color color.Color) {
+	label.color = color
+	label.renderText()
+}
+
+// SetBackgroundColor sets the color of a box behind the text and the space in pixels around the text, nil for no box
+func (label *Label) SetBackgroundColor(background color.Color, padding int) {
+	label.background = background
+	label.padding = padding
+	label.renderText()
+}
+
+// renderText rasterizes the text into the image of the billboard
+func (label *Label) renderText() {
+	labelFont := label.font
+	if labelFont == nil {
+		goRegularOnce.Do(func() {
+			goRegular, _ = opentype.Parse(goregular.TTF)
+		})
+		labelFont = goRegular
+	}
+	face, err := opentype.NewFace(labelFont, &opentype.FaceOptions{Size: label.fontSize, DPI: 72, Hinting: font.HintingFull})
+	if err != nil {
+		label.image = nil
+		return
+	}
+	defer face.Close()
+
+	lines := strings.Split(label.text, "\n")
+	metrics := face.Metrics()
+	lineHeight := metrics.Height.Ceil()
+	width := 0
+	for _, line := range lines {
+		width = max(width, font.MeasureString(face, line).Ceil())
+	}
+	img := image.NewRGBA(image.Rect(0, 0, width+2*label.padding, lineHeight*len(lines)+2*label.padding))
+	if label.background != nil {
+		draw.Draw(img, img.Bounds(), image.NewUniform(label.background), image.Point{}, draw.Src)
+	}
+	drawer := &font.Drawer{Dst: img, Src: image.NewUniform(label.color), Face: face}
+	for i, line := range lines {
+		lineWidth := font.MeasureString(face, line).Ceil()
+		// Every line is centered in the box
+		x := label.padding + int(math.Floor(float64(width-lineWidth)/2))
+		y := label.padding + i*lineHeight + metrics.Ascent.Ceil()
+		drawer.Dot = fixed.P(x, y)
+		drawer.DrawString(line)
+	}
+	label.SetImage(img)
+}
@@ -0,0 +1,83 @@
+package object
+
+import (
+	mgl "github.com/go-gl/mathgl/mgl64"
+	"github.com/virus-rpi/ThreeDView/types"
+	"image/color"
+	"math"
+)
+
+// localEdge is an edge of the faces of an Object in local space
+type localEdge struct {
+	points  [2]mgl.Vec3
+	normals []mgl.Vec3 // The geometric normals of the faces that share the edge
+	color   color.Color
+}
+
+// vertexKey identifies a vertex position, rounded so tiny differences between the faces sharing it don't split an edge
+type vertexKey [3]int64
+
+func keyOf(point mgl.Vec3) vertexKey {
+	return vertexKey{int64(math.Round(point.X() * 1e6)), int64(math.Round(point.Y() * 1e6)), int64(math.Round(point.Z() * 1e6))}
+}
+
+func (key vertexKey) less(other vertexKey) bool {
+	for i := range key {
+		if key[i] != other[i] {
+			return key[i] < other[i]
+		}
+	}
+	return false
+}
+
+// buildEdges collects the edges of the faces. Edges with the same end points are merged no matter their direction,
+// so every edge is listed once with the normals of all faces that share it
+func buildEdges(faces []types.FaceData) []localEdge {
+	edges := make([]localEdge, 0, len(faces)*3/2)
+	index := make(map[[2]vertexKey]int, len(faces)*3/2)
+	for _, face := range faces {
+		normal := face.Face[1].Sub(face.Face[0]).Cross(face.Face[2].Sub(face.Face[0]))
+		if normal.Len() == 0 {
+			continue
+		}
+		normal = normal.Normalize()
+		for i := range face.Face {
+			start, end := face.Face[i], face.Face[(i+1)%3]
+			startKey, endKey := keyOf(start), keyOf(end)
+			key := [2]vertexKey{startKey, endKey}
+			if endKey.less(startKey) {
+				key = [2]vertexKey{endKey, startKey}
+			}
+			if j, ok := index[key]; ok {
+				edges[j].normals = append(edges[j].normals, normal)
+				continue
+			}
+			index[key] = len(edges)
+			edges = append(edges, localEdge{points: [2]mgl.Vec3{start, end}, normals: []mgl.Vec3{normal}, color: face.AverageColor()})
+		}
+	}
+	return edges
+}
+
+// Edges returns every edge of the faces once in world space. The edge list is built on first use and kept until the faces change
+func (object *Object) Edges() []types.EdgeData {
+	if object.edges == nil {
+		object.edges = buildEdges(object.faces)
+	}
+	edges := make([]types.EdgeData, len(object.edges))
+	for i, edge := range object.edges {
+		normals := make([]mgl.Vec3, len(edge.normals))
+		for j, normal := range edge.normals {
+			normals[j] = object.rotation.Rotate(normal)
+		}
+		edges[i] = types.EdgeData{
+			Points: [2]mgl.Vec3{
+				object.rotation.Rotate(edge.points[0]).Add(object.position),
+				object.rotation.Rotate(edge.points[1]).Add(object.position),
+			},
+			FaceNormals: normals,
+			Color:       edge.color,
+		}
+	}
+	return edges
+}
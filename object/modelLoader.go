@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"github.com/flywave/go-earcut"
 	mgl "github.com/go-gl/mathgl/mgl64"
+	"github.com/virus-rpi/ThreeDView/texture"
 	"github.com/virus-rpi/ThreeDView/types"
 	"image"
 	"image/color"
@@ -64,8 +65,37 @@ func getAverageColorFromTexture(img image.Image, texCoords []mgl.Vec2) color.Col
 	}
 }
 
+// parseVertexColor parses the red, green and blue channel that follow the position of a vertex in the common
+// "v x y z r g b" extension. Channels are from 0 to 1, or from 0 to 255 if any of them is larger than 1.
+// Returns nil if the vertex has no color
+func parseVertexColor(tokens []string) color.Color {
+	if len(tokens) < 3 {
+		return nil
+	}
+	var channels [3]float64
+	maxChannel := 1.0
+	for i := range channels {
+		value, err := strconv.ParseFloat(tokens[i], 64)
+		if err != nil {
+			return nil
+		}
+		channels[i] = value
+		maxChannel = math.Max(maxChannel, value)
+	}
+	if maxChannel > 1 {
+		maxChannel = 255
+	}
+	toByte := func(value float64) uint8 {
+		return uint8(math.Round(math.Min(math.Max(value/maxChannel, 0), 1) * 255))
+	}
+	return color.RGBA{R: toByte(channels[0]), G: toByte(channels[1]), B: toByte(channels[2]), A: 255}
+}
+
 // NewObjectFromObjFile parses a Wavefront OBJ file at 'path', triangulates all faces
+// Vertex normals (vn) are used for smooth shading if every vertex of a face references one
+// Vertex colors ("v x y z r g b") are interpolated across a face if every vertex of the face has one
 // If texturePath is provided, it will use the texture to determine face colors
+// and the faces are textured with bilinear filtering, mipmaps and repeat wrapping
 func NewObjectFromObjFile(path string, position mgl.Vec3, rotation mgl.Quat, scale float64, col color.Color, texturePath string, w types.ThreeDWidgetInterface) (*Object, error) {
 	file, err := os.Open(path)
 	if err != nil {
@@ -75,6 +105,8 @@ func NewObjectFromObjFile(path string, position mgl.Vec3, rotation mgl.Quat, sca
 
 	var vertices []mgl.Vec3
 	var texCoords []mgl.Vec2
+	var normals []mgl.Vec3
+	var vertexColors []color.Color // nil for vertices without a color
 	var facesData []types.FaceData
 
 	var textureImg image.Image
@@ -85,10 +117,11 @@ func NewObjectFromObjFile(path string, position mgl.Vec3, rotation mgl.Quat, sca
 		}
 		defer textureFile.Close()
 
-		textureImg, _, err = image.Decode(textureFile)
+		decoded, _, err := image.Decode(textureFile)
 		if err != nil {
 			return nil, fmt.Errorf("failed to decode texture image: %v", err)
 		}
+		textureImg = texture.NewTexture(decoded)
 	}
 
 	scanner := bufio.NewScanner(file)
@@ -108,6 +141,7 @@ func NewObjectFromObjFile(path string, position mgl.Vec3, rotation mgl.Quat, sca
 			y, _ := strconv.ParseFloat(tokens[2], 64)
 			z, _ := strconv.ParseFloat(tokens[3], 64)
 			vertices = append(vertices, mgl.Vec3{x * scale, y * scale, z * scale})
+			vertexColors = append(vertexColors, parseVertexColor(tokens[4:]))
 
 		case "vt":
 			if len(tokens) < 3 {
@@ -117,10 +151,20 @@ func NewObjectFromObjFile(path string, position mgl.Vec3, rotation mgl.Quat, sca
 			v, _ := strconv.ParseFloat(tokens[2], 64)
 			texCoords = append(texCoords, mgl.Vec2{u, v})
 
+		case "vn":
+			if len(tokens) < 4 {
+				continue
+			}
+			x, _ := strconv.ParseFloat(tokens[1], 64)
+			y, _ := strconv.ParseFloat(tokens[2], 64)
+			z, _ := strconv.ParseFloat(tokens[3], 64)
+			normals = append(normals, mgl.Vec3{x, y, z}.Normalize())
+
 		case "f":
 			var faceVertices []float64
 			var vertexIndices []int
 			var texCoordIndices []int
+			var normalIndices []int
 
 			for _, tok := range tokens[1:] {
 				parts := strings.Split(tok, "/")
@@ -150,6 +194,20 @@ func NewObjectFromObjFile(path string, position mgl.Vec3, rotation mgl.Quat, sca
 						}
 					}
 				}
+
+				if len(parts) > 2 && parts[2] != "" {
+					ni, err := strconv.Atoi(parts[2])
+					if err == nil {
+						if ni < 0 {
+							ni = len(normals) + ni
+						} else {
+							ni--
+						}
+						if ni >= 0 && ni < len(normals) {
+							normalIndices = append(normalIndices, ni)
+						}
+					}
+				}
 			}
 
 			var holes []int
@@ -173,6 +231,22 @@ func NewObjectFromObjFile(path string, position mgl.Vec3, rotation mgl.Quat, sca
 					Color: faceColor,
 				}
 
+				// Use the vertex normals if every vertex of the face has one
+				if len(normalIndices) == len(vertexIndices) {
+					faceData.Normals = [3]mgl.Vec3{
+						normals[normalIndices[idx1]],
+						normals[normalIndices[idx2]],
+						normals[normalIndices[idx3]],
+					}
+					faceData.HasNormals = true
+				}
+
+				// Use the vertex colors if every vertex of the face has one
+				if c1, c2, c3 := vertexColors[vertexIndices[idx1]], vertexColors[vertexIndices[idx2]], vertexColors[vertexIndices[idx3]]; c1 != nil && c2 != nil && c3 != nil {
+					faceData.Colors = [3]color.Color{c1, c2, c3}
+					faceData.HasColors = true
+				}
+
 				// Handle texture if available
 				if textureImg != nil && len(texCoordIndices) >= 3 {
 					var triangleTexCoords []mgl.Vec2
@@ -217,6 +291,7 @@ func NewObjectFromObjFile(path string, position mgl.Vec3, rotation mgl.Quat, sca
 		position: position,
 		rotation: rotation,
 		widget:   w,
+		material: types.NewMaterial(),
 	}
 	w.AddObject(obj)
 	return obj, nil
@@ -47,6 +47,7 @@ func NewCube(size Unit, position mgl.Vec3, rotation mgl.Quat, color color.Color,
 		position: position,
 		rotation: rotation,
 		widget:   w,
+		material: NewMaterial(),
 	}
 	w.AddObject(&cube)
 	return &cube
@@ -95,6 +96,7 @@ func NewPlane(size Unit, position mgl.Vec3, rotation mgl.Quat, color color.Color
 		position: position,
 		rotation: rotation,
 		widget:   w,
+		material: NewMaterial(),
 	}
 	w.AddObject(&plane)
 	return &plane
@@ -161,6 +163,7 @@ func NewOrientationObject(w ThreeDWidgetInterface) *Object {
 		position: mgl.Vec3{0, 0, 0},
 		rotation: mgl.QuatIdent(),
 		widget:   w,
+		material: NewMaterial(),
 	}
 	w.RegisterTickMethod(func() {
 		desiredPixelSize := 40
@@ -184,6 +187,7 @@ func NewEmpty(w ThreeDWidgetInterface, position mgl.Vec3) *Object {
 		position: position,
 		rotation: mgl.QuatIdent(),
 		widget:   w,
+		material: NewMaterial(),
 	}
 	w.AddObject(&empty)
 	return &empty
@@ -233,6 +237,7 @@ func NewCylinder(position mgl.Vec3, rotation mgl.Quat, color color.Color, w Thre
 		position: position,
 		rotation: rotation,
 		widget:   w,
+		material: NewMaterial(),
 	}
 	w.AddObject(&cylinder)
 	return &cylinder
@@ -274,6 +279,7 @@ func NewCone(position mgl.Vec3, rotation mgl.Quat, color color.Color, w ThreeDWi
 		position: position,
 		rotation: rotation,
 		widget:   w,
+		material: NewMaterial(),
 	}
 	w.AddObject(&cone)
 	return &cone
@@ -5,18 +5,33 @@ import (
 	"github.com/virus-rpi/ThreeDView/types"
 	"image"
 	"image/color"
+	"math"
 	"sync"
 )
 
 // ProjectedFaceData represents a face projected to 2D space
 type ProjectedFaceData struct {
-	Face         [3]mgl.Vec2 // The Face in 2D space as 3 2d points
-	Z            [3]float64  // The Z (depth) value for each vertex
-	Color        color.Color // The Color of the Face
-	Distance     types.Unit  // The Distance of the un-projected Face from the camera in 3d world space
-	TextureImage image.Image // The texture image for the face (nil if no texture)
-	TexCoords    [3]mgl.Vec2 // Texture coordinates for each vertex
-	HasTexture   bool        // Whether this face has texture information
+	Face         [3]mgl.Vec2           // The Face in 2D space as 3 2d points
+	Z            [3]float64            // The Z (depth) value for each vertex
+	W            [3]float64            // The clip space W for each vertex, used for perspective correct interpolation
+	Color        color.Color           // The Color of the Face, the average of the vertex colors if it has per-vertex colors
+	Colors       [3]color.RGBA         // The premultiplied color of each vertex, used instead of Color if HasColors is set
+	HasColors    bool                  // Whether the color is interpolated across the face from the vertex colors
+	Distance     types.Unit            // The Distance of the un-projected Face from the camera in 3d world space
+	TextureImage image.Image           // The texture image for the face (nil if no texture)
+	TexCoords    [3]mgl.Vec2           // Texture coordinates for each vertex
+	HasTexture   bool                  // Whether this face has texture information
+	Lit          bool                  // Whether the face is affected by light
+	Shading      types.ShadingMode     // How the light is interpolated across the face
+	Diffuse      [3]mgl.Vec3           // The ambient and diffuse light the color is multiplied with for each vertex
+	Specular     [3]mgl.Vec3           // The specular light added to the color for each vertex
+	Positions    [3]mgl.Vec3           // The world space position of each vertex
+	Normals      [3]mgl.Vec3           // The world space normal of each vertex, turned towards the camera
+	Material     *types.Material       // The material of the face, never nil
+	Object       types.ObjectInterface // The object the face belongs to
+	FaceIndex    int                   // The index of the face in the faces of its object
+	DepthBias    float64               // The fraction of its distance the face is moved along the view direction before the depth test
+	ID           int32                 // The value written to the ID buffer for this face, 0 if it isn't pickable
 }
 
 // Object represents a 3D shape in world space
@@ -25,10 +40,14 @@ type Object struct {
 	rotation mgl.Quat                    // Rotation of the Object in world space (now quaternion)
 	position mgl.Vec3                    // Position of the Object in world space
 	widget   types.ThreeDWidgetInterface // The widget the Object is in
+	material *types.Material             // The material used for all faces without an own material
+	outline  color.Color                 // The color of the edge outlines of the Object, nil for the default color
+	edges    []localEdge                 // The deduplicated edges of the faces in local space, nil until they are needed
 }
 
 func (object *Object) SetFaces(faces []types.FaceData) {
 	object.faces = faces
+	object.edges = nil
 	object.widget.GetCamera().RebuildOctree()
 }
 
@@ -59,8 +78,100 @@ func (object *Object) SetWidget(widget types.ThreeDWidgetInterface) {
 	object.widget.GetCamera().RebuildOctree()
 }
 
-func (object *Object) transformFace(face types.FaceData) types.FaceData {
+// Material returns the material of the Object. Changes to it affect all faces without an own material
+func (object *Object) Material() *types.Material {
+	return object.material
+}
+
+// SetMaterial sets the material used for all faces of the Object without an own material. nil restores a new default material.
+// An opacity of 0, like in a Material{} that wasn't created with NewMaterial, is set to 1, because it would hide the Object.
+// Use SetOpacity to make the Object invisible on purpose
+func (object *Object) SetMaterial(material *types.Material) {
+	if material == nil {
+		material = types.NewMaterial()
+	}
+	if material.Opacity == 0 {
+		material.Opacity = 1
+	}
+	object.material = material
+	// The faces in the octree point to the material they had when it was built
+	object.widget.GetCamera().RebuildOctree()
+}
+
+// SetShading sets how light is calculated across the faces of the Object
+func (object *Object) SetShading(shading types.ShadingMode) {
+	object.material.Shading = shading
+}
+
+// SetCulling sets which side of the faces of the Object is skipped. Use CullBack for closed meshes and CullNone for open ones
+func (object *Object) SetCulling(mode types.CullMode) {
+	object.material.Cull = mode
+}
+
+// SetOpacity sets the opacity of the Object. With an opacity below 1 the Object is blended with what is behind it
+func (object *Object) SetOpacity(opacity float64) {
+	object.material.Opacity = opacity
+}
+
+// SetTransparent sets whether the Object is always blended with what is behind it, for example for a texture with translucent parts.
+// Objects with an opacity below 1 are blended either way
+func (object *Object) SetTransparent(transparent bool) {
+	object.material.Transparent = transparent
+}
+
+// SetAlphaCutoff discards the pixels of the Object with an alpha below the cutoff, for cutouts like foliage.
+// The cutoff is clamped to the range 0 to 1, 0 disables the alpha test
+func (object *Object) SetAlphaCutoff(cutoff float64) {
+	object.material.AlphaCutoff = math.Max(0, math.Min(1, cutoff))
+}
+
+// SetCastShadows sets whether the Object casts shadows onto other faces
+func (object *Object) SetCastShadows(castShadows bool) {
+	object.material.CastShadows = castShadows
+}
+
+// SetReceiveShadows sets whether the shadows of other faces fall onto the Object
+func (object *Object) SetReceiveShadows(receiveShadows bool) {
+	object.material.ReceiveShadows = receiveShadows
+}
+
+// SetToonShading quantizes the light on the Object into the number of bands for a cel shaded look. 0 disables cel shading
+func (object *Object) SetToonShading(bands int) {
+	object.material.ToonBands = bands
+}
+
+// SetToonRamp sets a ramp image the light on the Object is looked up in for cel shading, from unlit (left) to fully lit (right).
+// It is used instead of the bands of SetToonShading. nil removes the ramp
+func (object *Object) SetToonRamp(ramp image.Image) {
+	object.material.ToonRamp = ramp
+}
+
+// SetDepthBias moves the Object along the view direction before the depth test, by the constant fraction of its distance
+// plus the slope factor times how much its distance changes per pixel. Negative values pull it towards the camera, so it is
+// drawn over coplanar faces without flickering
+func (object *Object) SetDepthBias(constant, slope float64) {
+	object.material.DepthBias = constant
+	object.material.DepthSlopeBias = slope
+}
+
+// SetLayer sets the draw layer of the Object. Where its faces are at the same depth as faces of a lower layer, they are drawn over them
+func (object *Object) SetLayer(layer int) {
+	object.material.Layer = layer
+}
+
+// OutlineColor returns the color of the edge outlines of the Object or nil if the default color is used
+func (object *Object) OutlineColor() color.Color {
+	return object.outline
+}
+
+// SetOutlineColor sets the color of the edge outlines of the Object. nil uses the color of the outline settings
+func (object *Object) SetOutlineColor(outlineColor color.Color) {
+	object.outline = outlineColor
+}
+
+func (object *Object) transformFace(index int, face types.FaceData) types.FaceData {
 	clonedFace := face
+	clonedFace.Index = index
 	clonedFace.Face = face.Face
 	clonedFace.Rotate(mgl.Vec3{}, object.rotation)
 	clonedFace.Add(object.position)
@@ -69,6 +180,9 @@ func (object *Object) transformFace(face types.FaceData) types.FaceData {
 	clonedFace.TextureImage = face.TextureImage
 	clonedFace.TexCoords = face.TexCoords
 	clonedFace.HasTexture = face.HasTexture
+	if clonedFace.Material == nil {
+		clonedFace.Material = object.material
+	}
 
 	return clonedFace
 }
@@ -81,7 +195,7 @@ func (object *Object) Faces() []types.FaceData {
 	for i, face := range object.faces {
 		go func(i int, face types.FaceData) {
 			defer wg.Done()
-			faces[i] = object.transformFace(face)
+			faces[i] = object.transformFace(i, face)
 		}(i, face)
 	}
 
@@ -96,11 +210,11 @@ func (object *Object) StreamFaces() <-chan types.FaceData {
 		var wg sync.WaitGroup
 		wg.Add(len(object.faces))
 
-		for _, face := range object.faces {
-			go func(face types.FaceData) {
+		for i, face := range object.faces {
+			go func(i int, face types.FaceData) {
 				defer wg.Done()
-				out <- object.transformFace(face)
-			}(face)
+				out <- object.transformFace(i, face)
+			}(i, face)
 		}
 
 		wg.Wait()
@@ -0,0 +1,126 @@
+package object
+
+import (
+	mgl "github.com/go-gl/mathgl/mgl64"
+	. "github.com/virus-rpi/ThreeDView/types"
+	"image/color"
+)
+
+// primitive contains the points and style shared by polylines and point sets
+type primitive struct {
+	Object
+	points    []mgl.Vec3    // The points in local space
+	colors    []color.Color // The color of every point, nil to use color for all
+	color     color.Color   // The color of all points without an own color
+	width     float64       // The width of lines or the diameter of points
+	widthMode WidthMode     // Whether the width is in pixels or world units
+}
+
+func newPrimitive(points []mgl.Vec3, color color.Color, width float64, widthMode WidthMode, w ThreeDWidgetInterface) primitive {
+	return primitive{
+		Object: Object{
+			position: mgl.Vec3{},
+			rotation: mgl.QuatIdent(),
+			widget:   w,
+			material: NewMaterial(),
+		},
+		points:    points,
+		color:     color,
+		width:     width,
+		widthMode: widthMode,
+	}
+}
+
+// Points returns the points in local space
+func (p *primitive) Points() []mgl.Vec3 {
+	return p.points
+}
+
+// SetPoints replaces all points. The points are in local space, relative to the position and rotation of the object
+func (p *primitive) SetPoints(points []mgl.Vec3) {
+	p.points = points
+}
+
+// AddPoint appends a point in local space, for example to extend a trajectory while it is recorded
+func (p *primitive) AddPoint(point mgl.Vec3) {
+	p.points = append(p.points, point)
+}
+
+// SetColor sets the color of all points without an own color
+func (p *primitive) SetColor(color color.Color) {
+	p.color = color
+}
+
+// SetColors sets the color of every point. Lines blend between the colors of their points. nil uses the color for all points
+func (p *primitive) SetColors(colors []color.Color) {
+	p.colors = colors
+}
+
+// SetWidth sets the width of lines or the diameter of points and whether it is in pixels or world units
+func (p *primitive) SetWidth(width float64, widthMode WidthMode) {
+	p.width = width
+	p.widthMode = widthMode
+}
+
+// primitiveData returns the points transformed to world space with the style and the depth bias and layer of the material
+func (p *primitive) primitiveData(kind PrimitiveKind) PrimitiveData {
+	points := make([]mgl.Vec3, len(p.points))
+	for i, point := range p.points {
+		points[i] = p.rotation.Rotate(point).Add(p.position)
+	}
+	var colors []color.Color
+	if p.colors != nil {
+		colors = append(colors, p.colors...)
+	}
+	return PrimitiveData{
+		Kind:      kind,
+		Points:    points,
+		Colors:    colors,
+		Color:     p.color,
+		Width:     p.width,
+		WidthMode: p.widthMode,
+		DepthBias: p.material.DepthBias,
+		Layer:     p.material.Layer,
+	}
+}
+
+// Polyline is an object drawn as lines between consecutive points, for example to show a trajectory
+type Polyline struct {
+	primitive
+	dash []float64 // Alternating lengths of dashes and gaps, empty for a solid line
+}
+
+// NewPolyline creates a solid polyline through the points in world space and adds it to the widget
+func NewPolyline(points []mgl.Vec3, color color.Color, width float64, widthMode WidthMode, w ThreeDWidgetInterface) *Polyline {
+	polyline := &Polyline{primitive: newPrimitive(points, color, width, widthMode, w)}
+	w.AddObject(polyline)
+	return polyline
+}
+
+// SetDash sets the alternating lengths of dashes and gaps along the line, in pixels or world units like the width.
+// No lengths draw a solid line
+func (polyline *Polyline) SetDash(lengths ...float64) {
+	polyline.dash = lengths
+}
+
+func (polyline *Polyline) Primitives() []PrimitiveData {
+	data := polyline.primitiveData(PrimitiveLineStrip)
+	data.Dash = append([]float64(nil), polyline.dash...)
+	return []PrimitiveData{data}
+}
+
+// PointSet is an object drawn as a round dot at every point, for example for point clouds or markers
+type PointSet struct {
+	primitive
+}
+
+// NewPointSet creates a set of dots at the points in world space and adds it to the widget
+func NewPointSet(points []mgl.Vec3, color color.Color, diameter float64, widthMode WidthMode, w ThreeDWidgetInterface) *PointSet {
+	pointSet := &PointSet{primitive: newPrimitive(points, color, diameter, widthMode, w)}
+	w.AddObject(pointSet)
+	return pointSet
+}
+
+func (pointSet *PointSet) Primitives() []PrimitiveData {
+	return []PrimitiveData{pointSet.primitiveData(PrimitivePoints)}
+}
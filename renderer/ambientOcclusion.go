@@ -0,0 +1,257 @@
+package renderer
+
+import (
+	mgl "github.com/go-gl/mathgl/mgl64"
+	"math"
+	"math/rand"
+)
+
+// ambientOcclusionPass darkens pixels by how much of the hemisphere above them is covered by nearby geometry,
+// estimated from the depth buffer (screen space ambient occlusion), configured by the settings of the widget
+type ambientOcclusionPass struct {
+	kernel    []mgl.Vec3 // Sample offsets in a unit hemisphere around +Z, denser close to the center
+	positions []mgl.Vec3 // Reused memory for the world position of every pixel at the occlusion resolution
+	distances []float64  // Reused memory for the distance of every pixel from the camera, +Inf for the background
+	occlusion []float64  // Reused memory for the visibility (1 is unoccluded) of every pixel
+	scratch   []float64  // Reused memory for the blur
+}
+
+// updateKernel creates the sample offsets if the sample count changed. The offsets are the same every frame so the result is stable
+func (pass *ambientOcclusionPass) updateKernel(samples int) {
+	if len(pass.kernel) == samples {
+		return
+	}
+	random := rand.New(rand.NewSource(1))
+	pass.kernel = make([]mgl.Vec3, samples)
+	for i := range pass.kernel {
+		sample := mgl.Vec3{random.Float64()*2 - 1, random.Float64()*2 - 1, random.Float64()}
+		for sample.Len() == 0 {
+			sample = mgl.Vec3{random.Float64()*2 - 1, random.Float64()*2 - 1, random.Float64()}
+		}
+		scale := float64(i) / float64(samples)
+		scale = 0.1 + 0.9*scale*scale
+		pass.kernel[i] = sample.Normalize().Mul(random.Float64() * scale)
+	}
+}
+
+// resize makes sure all reused memory fits the number of pixels
+func (pass *ambientOcclusionPass) resize(size int) {
+	if cap(pass.positions) < size {
+		pass.positions = make([]mgl.Vec3, size)
+		pass.distances = make([]float64, size)
+		pass.occlusion = make([]float64, size)
+		pass.scratch = make([]float64, size)
+	}
+	pass.positions, pass.distances = pass.positions[:size], pass.distances[:size]
+	pass.occlusion, pass.scratch = pass.occlusion[:size], pass.scratch[:size]
+}
+
+func (pass *ambientOcclusionPass) Apply(buffers *FrameBuffers) {
+	settings := buffers.Widget.GetAmbientOcclusionSettings()
+	if settings.Samples <= 0 || settings.Radius <= 0 {
+		return
+	}
+	pass.updateKernel(settings.Samples)
+	cameraPosition := buffers.Widget.GetCamera().Position()
+
+	// The occlusion is calculated on a grid that is optionally half the resolution of the frame
+	scale := 1
+	if settings.HalfResolution {
+		scale = 2
+	}
+	width, height := buffers.Depth.Width, buffers.Depth.Height
+	gridWidth, gridHeight := (width+scale-1)/scale, (height+scale-1)/scale
+	pass.resize(gridWidth * gridHeight)
+
+	parallelRows(gridHeight, func(minY, maxY int) {
+		for y := minY; y < maxY; y++ {
+			for x := 0; x < gridWidth; x++ {
+				i := y*gridWidth + x
+				position, ok := buffers.WorldPosition(x*scale, y*scale)
+				pass.positions[i] = position
+				pass.distances[i] = math.Inf(1)
+				if ok {
+					pass.distances[i] = position.Sub(cameraPosition).Len()
+				}
+			}
+		}
+	})
+
+	radius, bias := float64(settings.Radius), float64(settings.Bias)
+	parallelRows(gridHeight, func(minY, maxY int) {
+		for y := minY; y < maxY; y++ {
+			for x := 0; x < gridWidth; x++ {
+				i := y*gridWidth + x
+				pass.occlusion[i] = 1
+				if math.IsInf(pass.distances[i], 1) {
+					continue
+				}
+				position := pass.positions[i]
+				normal := pass.normalAt(x, y, gridWidth, gridHeight, cameraPosition)
+				if normal == (mgl.Vec3{}) {
+					continue
+				}
+
+				// The kernel is rotated around the normal by a different angle in every pixel of a 4x4 pattern,
+				// the blur averages the resulting noise away
+				angle := 2 * math.Pi * float64((x%4)*4+y%4) / 16
+				tangent, bitangent := hemisphereBasis(normal, angle)
+
+				occluded := 0.0
+				for _, offset := range pass.kernel {
+					sample := position.Add(tangent.Mul(offset.X() * radius)).Add(bitangent.Mul(offset.Y() * radius)).Add(normal.Mul(offset.Z() * radius))
+					sx, sy, _, ok := buffers.Project(sample)
+					if !ok {
+						continue
+					}
+					surface, ok := buffers.WorldPosition(int(sx), int(sy))
+					if !ok {
+						continue
+					}
+					if surface.Sub(cameraPosition).Len() < sample.Sub(cameraPosition).Len()-bias {
+						// Geometry far in front of the point (like a foreground object) only occludes a little
+						occluded += smoothstep(0, 1, radius/math.Max(surface.Sub(position).Len(), 1e-9))
+					}
+				}
+				visibility := 1 - occluded/float64(len(pass.kernel))
+				pass.occlusion[i] = math.Pow(math.Max(visibility, 0), settings.Intensity)
+			}
+		}
+	})
+
+	if settings.BlurRadius > 0 {
+		bilateralBlur(pass.occlusion, pass.scratch, pass.distances, gridWidth, gridHeight, settings.BlurRadius)
+	}
+
+	parallelRows(height, func(minY, maxY int) {
+		for y := minY; y < maxY; y++ {
+			for x := 0; x < width; x++ {
+				visibility := pass.occlusion[(y/scale)*gridWidth+x/scale]
+				if scale > 1 {
+					visibility = pass.upsample(buffers, x, y, scale, gridWidth, gridHeight, cameraPosition)
+				}
+				if visibility >= 1 {
+					continue
+				}
+				c := pixelAt(buffers.Color, x, y)
+				c.R = uint8(float64(c.R) * visibility)
+				c.G = uint8(float64(c.G) * visibility)
+				c.B = uint8(float64(c.B) * visibility)
+				setPixel(buffers.Color, x, y, c)
+			}
+		}
+	})
+}
+
+// normalAt reconstructs the normal of a grid pixel from the positions of its neighbours.
+// Of the two neighbours on each axis the one with the closer distance is used, so normals don't bend over depth edges.
+// Returns the zero vector if no normal can be reconstructed
+func (pass *ambientOcclusionPass) normalAt(x, y, gridWidth, gridHeight int, cameraPosition mgl.Vec3) mgl.Vec3 {
+	i := y*gridWidth + x
+	position, distance := pass.positions[i], pass.distances[i]
+	// derivative returns the position difference to the better neighbour in one direction
+	derivative := func(before, after int, hasBefore, hasAfter bool) (mgl.Vec3, bool) {
+		bestDifference := math.Inf(1)
+		var best mgl.Vec3
+		if hasAfter && math.Abs(pass.distances[after]-distance) < bestDifference {
+			bestDifference = math.Abs(pass.distances[after] - distance)
+			best = pass.positions[after].Sub(position)
+		}
+		if hasBefore && math.Abs(pass.distances[before]-distance) < bestDifference {
+			bestDifference = math.Abs(pass.distances[before] - distance)
+			best = position.Sub(pass.positions[before])
+		}
+		return best, !math.IsInf(bestDifference, 1) && !math.IsNaN(bestDifference)
+	}
+	dx, okX := derivative(i-1, i+1, x > 0, x+1 < gridWidth)
+	dy, okY := derivative(i-gridWidth, i+gridWidth, y > 0, y+1 < gridHeight)
+	if !okX || !okY {
+		return mgl.Vec3{}
+	}
+	normal := dx.Cross(dy)
+	if normal.Len() == 0 {
+		return mgl.Vec3{}
+	}
+	normal = normal.Normalize()
+	if normal.Dot(cameraPosition.Sub(position)) < 0 {
+		normal = normal.Mul(-1)
+	}
+	return normal
+}
+
+// upsample returns the visibility of a full resolution pixel from the grid pixel next to it with the most similar distance
+func (pass *ambientOcclusionPass) upsample(buffers *FrameBuffers, x, y, scale, gridWidth, gridHeight int, cameraPosition mgl.Vec3) float64 {
+	position, ok := buffers.WorldPosition(x, y)
+	if !ok {
+		return 1
+	}
+	distance := position.Sub(cameraPosition).Len()
+	gx, gy := x/scale, y/scale
+	best, bestDifference := pass.occlusion[gy*gridWidth+gx], math.Inf(1)
+	for _, neighbour := range [4][2]int{{gx, gy}, {gx + 1, gy}, {gx, gy + 1}, {gx + 1, gy + 1}} {
+		if neighbour[0] >= gridWidth || neighbour[1] >= gridHeight {
+			continue
+		}
+		i := neighbour[1]*gridWidth + neighbour[0]
+		if difference := math.Abs(pass.distances[i] - distance); difference < bestDifference {
+			best, bestDifference = pass.occlusion[i], difference
+		}
+	}
+	return best
+}
+
+// hemisphereBasis returns two axes that form an orthonormal basis with the normal, rotated around it by the angle
+func hemisphereBasis(normal mgl.Vec3, angle float64) (tangent, bitangent mgl.Vec3) {
+	helper := mgl.Vec3{1, 0, 0}
+	if math.Abs(normal.X()) > 0.9 {
+		helper = mgl.Vec3{0, 1, 0}
+	}
+	tangent = helper.Sub(normal.Mul(helper.Dot(normal))).Normalize()
+	bitangent = normal.Cross(tangent)
+	rotated := tangent.Mul(math.Cos(angle)).Add(bitangent.Mul(math.Sin(angle)))
+	return rotated, normal.Cross(rotated)
+}
+
+// bilateralBlur blurs values horizontally and then vertically. Neighbours are weighted by how similar their distance is,
+// so values don't bleed over depth edges. scratch has to be as large as values
+func bilateralBlur(values, scratch, distances []float64, width, height, radius int) {
+	blur := func(source, destination []float64, stepX, stepY int) {
+		parallelRows(height, func(minY, maxY int) {
+			for y := minY; y < maxY; y++ {
+				for x := 0; x < width; x++ {
+					i := y*width + x
+					distance := distances[i]
+					if math.IsInf(distance, 1) {
+						destination[i] = source[i]
+						continue
+					}
+					sum, weights := 0.0, 0.0
+					for offset := -radius; offset <= radius; offset++ {
+						nx, ny := x+offset*stepX, y+offset*stepY
+						if nx < 0 || ny < 0 || nx >= width || ny >= height {
+							continue
+						}
+						j := ny*width + nx
+						// A relative distance difference of 10% halves the weight roughly
+						difference := (distances[j] - distance) / (distance * 0.1)
+						weight := math.Exp(-difference * difference)
+						if math.IsNaN(weight) {
+							continue
+						}
+						sum += source[j] * weight
+						weights += weight
+					}
+					destination[i] = sum / weights
+				}
+			}
+		})
+	}
+	blur(values, scratch, 1, 0)
+	blur(scratch, values, 0, 1)
+}
+
+// smoothstep returns 0 below edge0, 1 above edge1 and a smooth transition between them
+func smoothstep(edge0, edge1, x float64) float64 {
+	t := math.Max(0, math.Min(1, (x-edge0)/(edge1-edge0)))
+	return t * t * (3 - 2*t)
+}
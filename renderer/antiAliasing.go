@@ -0,0 +1,211 @@
+package renderer
+
+import (
+	mgl "github.com/go-gl/mathgl/mgl64"
+	"image"
+	"image/color"
+	"math"
+)
+
+const (
+	fxaaEdgeThreshold    = 0.125  // Minimum contrast relative to the brightest neighbour to count as an edge
+	fxaaEdgeThresholdMin = 0.0312 // Minimum absolute contrast to count as an edge, so dark regions are skipped
+	fxaaSubpixelQuality  = 0.75   // How much single pixel details like thin lines are blurred
+)
+
+// fxaaSearchSteps are the distances walked along an edge per iteration while searching for its ends
+var fxaaSearchSteps = [...]float64{1, 1, 1, 1, 1, 1.5, 2, 2, 2, 2, 4, 8}
+
+// resolveSamples averages every factor x factor block of samples into one pixel of the destination image.
+// The destination depth is the nearest depth of the samples, so depth based passes still see thin geometry.
+// The normal is the one of the nearest sample. The ID is the one of the sample that is nearest in idDepth, which is the
+// sample depth unless the IDs were rasterized with their own depth. Optional buffers are skipped if they are nil in either buffers
+func resolveSamples(sampleBuffers *FrameBuffers, dstBuffers *FrameBuffers, idDepth *DepthBuffer, factor int) {
+	samples, sampleDepth, sampleIDs, sampleNormals := sampleBuffers.Color, sampleBuffers.Depth, sampleBuffers.IDs, sampleBuffers.Normals
+	dst, dstDepth, dstIDs, dstNormals := dstBuffers.Color, dstBuffers.Depth, dstBuffers.IDs, dstBuffers.Normals
+	resolveIDs := sampleIDs != nil && dstIDs != nil
+	resolveNormals := sampleNormals != nil && dstNormals != nil
+	width, height := dstDepth.Width, dstDepth.Height
+	count := uint32(factor * factor)
+	parallelRows(height, func(minY, maxY int) {
+		for y := minY; y < maxY; y++ {
+			for x := 0; x < width; x++ {
+				var r, g, b, a uint32
+				nearest, nearestIDDepth := math.Inf(1), math.Inf(1)
+				var nearestID int32
+				var nearestNormal mgl.Vec3
+				for sy := y * factor; sy < (y+1)*factor; sy++ {
+					i := sy*samples.Stride + x*factor*4
+					depthIndex := sampleDepth.Index(x*factor, sy)
+					for sx := 0; sx < factor; sx++ {
+						r += uint32(samples.Pix[i])
+						g += uint32(samples.Pix[i+1])
+						b += uint32(samples.Pix[i+2])
+						a += uint32(samples.Pix[i+3])
+						if depth := sampleDepth.Values[depthIndex+sx]; depth < nearest {
+							nearest = depth
+							if resolveNormals {
+								nearestNormal = sampleNormals.Values[depthIndex+sx]
+							}
+						}
+						if resolveIDs {
+							if depth := idDepth.Values[depthIndex+sx]; depth < nearestIDDepth {
+								nearestIDDepth = depth
+								nearestID = sampleIDs.Values[depthIndex+sx]
+							}
+						}
+						i += 4
+					}
+				}
+				i := y*dst.Stride + x*4
+				dst.Pix[i] = uint8((r + count/2) / count)
+				dst.Pix[i+1] = uint8((g + count/2) / count)
+				dst.Pix[i+2] = uint8((b + count/2) / count)
+				dst.Pix[i+3] = uint8((a + count/2) / count)
+				dstDepth.Values[dstDepth.Index(x, y)] = nearest
+				if resolveIDs {
+					dstIDs.Values[dstIDs.Index(x, y)] = nearestID
+				}
+				if resolveNormals {
+					dstNormals.Values[dstNormals.Index(x, y)] = nearestNormal
+				}
+			}
+		}
+	})
+}
+
+// applyFXAA smooths edges of the image based on luminance contrast (fast approximate anti-aliasing).
+// For every pixel on an edge the edge direction and its ends are searched, and the pixel is blended with
+// its neighbour across the edge depending on its position along the edge.
+// source receives a copy of the unfiltered image and luma the luminance of every pixel, both are reused memory
+func applyFXAA(img *image.RGBA, source *image.RGBA, luma []float64) {
+	copy(source.Pix, img.Pix)
+	width, height := img.Bounds().Dx(), img.Bounds().Dy()
+	if width < 3 || height < 3 {
+		return
+	}
+	parallelRows(height, func(minY, maxY int) {
+		for y := minY; y < maxY; y++ {
+			for x := 0; x < width; x++ {
+				c := pixelAt(source, x, y)
+				luma[y*width+x] = (0.299*float64(c.R) + 0.587*float64(c.G) + 0.114*float64(c.B)) / 255
+			}
+		}
+	})
+
+	// lumaAt returns the luminance at a pixel, clamped to the image borders
+	lumaAt := func(x, y int) float64 {
+		return luma[min(max(y, 0), height-1)*width+min(max(x, 0), width-1)]
+	}
+	// lumaAlong returns the luminance interpolated between the two pixel rows (or columns) next to an edge
+	// at a fractional position along the edge
+	lumaAlong := func(horizontal bool, along float64, x, y, acrossX, acrossY int) float64 {
+		first := int(math.Floor(along))
+		t := along - float64(first)
+		sample := func(position int) float64 {
+			if horizontal {
+				return (lumaAt(position, y) + lumaAt(position+acrossX, y+acrossY)) / 2
+			}
+			return (lumaAt(x, position) + lumaAt(x+acrossX, position+acrossY)) / 2
+		}
+		if t == 0 {
+			return sample(first)
+		}
+		return sample(first)*(1-t) + sample(first+1)*t
+	}
+
+	parallelRows(height, func(minY, maxY int) {
+		for y := minY; y < maxY; y++ {
+			for x := 0; x < width; x++ {
+				lumaCenter := lumaAt(x, y)
+				lumaNorth, lumaSouth := lumaAt(x, y-1), lumaAt(x, y+1)
+				lumaWest, lumaEast := lumaAt(x-1, y), lumaAt(x+1, y)
+				lumaMax := math.Max(lumaCenter, math.Max(math.Max(lumaNorth, lumaSouth), math.Max(lumaWest, lumaEast)))
+				lumaMin := math.Min(lumaCenter, math.Min(math.Min(lumaNorth, lumaSouth), math.Min(lumaWest, lumaEast)))
+				lumaRange := lumaMax - lumaMin
+				if lumaRange < math.Max(fxaaEdgeThresholdMin, lumaMax*fxaaEdgeThreshold) {
+					continue
+				}
+
+				lumaNorthWest, lumaNorthEast := lumaAt(x-1, y-1), lumaAt(x+1, y-1)
+				lumaSouthWest, lumaSouthEast := lumaAt(x-1, y+1), lumaAt(x+1, y+1)
+
+				// A pixel that differs from the average of its neighbours is blurred even if it isn't on a long edge
+				lumaAverage := (2*(lumaNorth+lumaSouth+lumaWest+lumaEast) + lumaNorthWest + lumaNorthEast + lumaSouthWest + lumaSouthEast) / 12
+				subpixel := math.Min(math.Abs(lumaAverage-lumaCenter)/lumaRange, 1)
+				subpixel = (-2*subpixel + 3) * subpixel * subpixel
+				subpixelOffset := subpixel * subpixel * fxaaSubpixelQuality
+
+				// The edge is horizontal if the luminance changes more vertically than horizontally
+				edgeHorizontal := math.Abs(lumaNorthWest-2*lumaWest+lumaSouthWest) + 2*math.Abs(lumaNorth-2*lumaCenter+lumaSouth) + math.Abs(lumaNorthEast-2*lumaEast+lumaSouthEast)
+				edgeVertical := math.Abs(lumaNorthWest-2*lumaNorth+lumaNorthEast) + 2*math.Abs(lumaWest-2*lumaCenter+lumaEast) + math.Abs(lumaSouthWest-2*lumaSouth+lumaSouthEast)
+				horizontal := edgeHorizontal >= edgeVertical
+
+				// Find on which side of the pixel the edge lies
+				luma1, luma2 := lumaNorth, lumaSouth
+				if !horizontal {
+					luma1, luma2 = lumaWest, lumaEast
+				}
+				gradient1, gradient2 := luma1-lumaCenter, luma2-lumaCenter
+				across, lumaLocalAverage := 1, (luma2+lumaCenter)/2
+				if math.Abs(gradient1) >= math.Abs(gradient2) {
+					across, lumaLocalAverage = -1, (luma1+lumaCenter)/2
+				}
+				gradientScaled := math.Max(math.Abs(gradient1), math.Abs(gradient2)) / 4
+				acrossX, acrossY := 0, across
+				along := float64(x)
+				if !horizontal {
+					acrossX, acrossY = across, 0
+					along = float64(y)
+				}
+
+				// Walk along the edge in both directions until the luminance differs from the edge average
+				distance1, distance2 := 0.0, 0.0
+				lumaEnd1, lumaEnd2 := lumaLocalAverage, lumaLocalAverage
+				reached1, reached2 := false, false
+				for _, step := range fxaaSearchSteps {
+					if !reached1 {
+						distance1 += step
+						lumaEnd1 = lumaAlong(horizontal, along-distance1, x, y, acrossX, acrossY) - lumaLocalAverage
+						reached1 = math.Abs(lumaEnd1) >= gradientScaled
+					}
+					if !reached2 {
+						distance2 += step
+						lumaEnd2 = lumaAlong(horizontal, along+distance2, x, y, acrossX, acrossY) - lumaLocalAverage
+						reached2 = math.Abs(lumaEnd2) >= gradientScaled
+					}
+					if reached1 && reached2 {
+						break
+					}
+				}
+
+				// Pixels close to the end of the edge the luminance changes towards are blended the most
+				distance, lumaEnd := distance2, lumaEnd2
+				if distance1 < distance2 {
+					distance, lumaEnd = distance1, lumaEnd1
+				}
+				edgeOffset := 0.0
+				if (lumaEnd < 0) != (lumaCenter < lumaLocalAverage) {
+					edgeOffset = 0.5 - distance/(distance1+distance2)
+				}
+				offset := math.Max(edgeOffset, subpixelOffset)
+				if offset <= 0 {
+					continue
+				}
+
+				neighbourX, neighbourY := min(max(x+acrossX, 0), width-1), min(max(y+acrossY, 0), height-1)
+				setPixel(img, x, y, mixColors(pixelAt(source, x, y), pixelAt(source, neighbourX, neighbourY), offset))
+			}
+		}
+	})
+}
+
+// mixColors linearly interpolates between two colors, t is the weight of the second color
+func mixColors(a, b color.RGBA, t float64) color.RGBA {
+	return color.RGBA{
+		R: uint8(float64(a.R)*(1-t) + float64(b.R)*t + 0.5),
+		G: uint8(float64(a.G)*(1-t) + float64(b.G)*t + 0.5),
+		B: uint8(float64(a.B)*(1-t) + float64(b.B)*t + 0.5),
+		A: uint8(float64(a.A)*(1-t) + float64(b.A)*t + 0.5),
+	}
+}
@@ -0,0 +1,33 @@
+package renderer
+
+import (
+	mgl "github.com/go-gl/mathgl/mgl64"
+	. "github.com/virus-rpi/ThreeDView/types"
+	"image"
+)
+
+// drawBackground fills the image with the background of the widget. Every pixel gets the color the background has
+// in the direction of the camera ray through the pixel center, so the background rotates with the camera
+func drawBackground(img *image.RGBA, background BackgroundInterface, camera CameraInterface) {
+	inverseViewProjection := camera.ViewProjection().Inv()
+	cameraPosition := camera.Position()
+	width, height := img.Bounds().Dx(), img.Bounds().Dy()
+	parallelRows(height, func(minY, maxY int) {
+		for y := minY; y < maxY; y++ {
+			ndcY := 1 - (float64(y)+0.5)/float64(height)*2
+			for x := 0; x < width; x++ {
+				ndcX := (float64(x)+0.5)/float64(width)*2 - 1
+				// The point on the near plane is far enough from the camera for a precise direction
+				point := inverseViewProjection.Mul4x1(mgl.Vec4{ndcX, ndcY, -1, 1})
+				if point.W() == 0 {
+					continue
+				}
+				direction := point.Vec3().Mul(1 / point.W()).Sub(cameraPosition)
+				if direction.Len() == 0 {
+					continue
+				}
+				setPixel(img, x, y, background.ColorAt(direction.Normalize()))
+			}
+		}
+	})
+}
@@ -0,0 +1,124 @@
+package renderer
+
+import (
+	mgl "github.com/go-gl/mathgl/mgl64"
+	"github.com/virus-rpi/ThreeDView/texture"
+	. "github.com/virus-rpi/ThreeDView/types"
+	"image"
+	"image/color"
+	"math"
+	"sort"
+)
+
+// projectedBillboard is a billboard with its position projected to the screen
+type projectedBillboard struct {
+	BillboardData
+	point mgl.Vec2 // The projected position in pixels
+	z, w  float64  // Depth buffer value and clip space W of the position
+}
+
+// renderBillboards draws the billboards of all objects over the finished image, so they stay sharp and aren't changed by
+// post processing. They are drawn from back to front and don't write depth
+func (r *Renderer) renderBillboards(target *FrameBuffers) {
+	cam := r.widget.GetCamera()
+	viewProjection := cam.ViewProjection()
+	pixelScale := worldToPixelScale(viewProjection, target.Depth.Width)
+	var billboards []projectedBillboard
+	for _, obj := range r.widget.GetObjects() {
+		billboardObject, ok := obj.(BillboardObject)
+		if !ok {
+			continue
+		}
+		for _, billboard := range billboardObject.Billboards() {
+			clip := viewProjection.Mul4x1(billboard.Position.Vec4(1))
+			// Positions behind the camera or outside the depth range aren't visible
+			if clip.W() <= 0 || clip.Z() < -clip.W() || clip.Z() > target.Depth.Range.FarNDC()*clip.W() {
+				continue
+			}
+			billboards = append(billboards, projectedBillboard{
+				BillboardData: billboard,
+				point:         cam.Project(billboard.Position),
+				z:             target.Depth.Range.Depth(clip.Z()/clip.W(), clip.W()),
+				w:             clip.W(),
+			})
+		}
+	}
+	sort.SliceStable(billboards, func(i, j int) bool {
+		return billboards[i].z > billboards[j].z
+	})
+	for _, billboard := range billboards {
+		drawBillboard(target, billboard, pixelScale)
+	}
+}
+
+// drawBillboard draws the image of a billboard and its leader line. With depth testing, faces closer than the position
+// of the billboard hide it, as if the image was a flat card at that depth
+func drawBillboard(target *FrameBuffers, billboard projectedBillboard, pixelScale float64) {
+	if billboard.Image == nil || billboard.Image.Bounds().Empty() {
+		return
+	}
+	img := texture.FromImage(billboard.Image)
+	imageWidth, imageHeight := float64(billboard.Image.Bounds().Dx()), float64(billboard.Image.Bounds().Dy())
+	height := imageHeight
+	if billboard.Size > 0 {
+		height = billboard.Size
+		if billboard.SizeMode == WidthWorld {
+			height = billboard.Size * pixelScale / billboard.w
+		}
+	}
+	scale := height / imageHeight
+	width := imageWidth * scale
+	pivot := billboard.point.Add(billboard.Offset)
+	topLeft := pivot.Sub(mgl.Vec2{billboard.Pivot.X() * width, billboard.Pivot.Y() * height})
+
+	if billboard.LeaderColor != nil && billboard.Offset.Len() > 0 {
+		leaderColor := color.RGBAModel.Convert(billboard.LeaderColor).(color.RGBA)
+		drawLeaderLine(target, billboard.point, pivot, leaderColor, billboard.z, billboard.DepthTest)
+	}
+
+	// Shrunk images are sampled from the mipmap with about one texel per pixel
+	lod := 0.0
+	if scale < 1 {
+		lod = math.Log2(1 / scale)
+	}
+	bounds := image.Rect(
+		int(math.Floor(topLeft.X())),
+		int(math.Floor(topLeft.Y())),
+		int(math.Ceil(topLeft.X()+width)),
+		int(math.Ceil(topLeft.Y()+height)),
+	).Intersect(image.Rect(0, 0, target.Depth.Width, target.Depth.Height))
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			if billboard.DepthTest && billboard.z >= target.Depth.Values[target.Depth.Index(x, y)] {
+				continue
+			}
+			u := (float64(x) + 0.5 - topLeft.X()) / width
+			v := 1 - (float64(y)+0.5-topLeft.Y())/height
+			if u < 0 || u > 1 || v < 0 || v > 1 {
+				continue
+			}
+			c := img.Sample(mgl.Vec2{u, v}, lod)
+			if c.A == 0 {
+				continue
+			}
+			blendPixel(target.Color, x, y, c)
+		}
+	}
+}
+
+// drawLeaderLine draws a line one pixel wide from the position of a billboard to its offset image
+func drawLeaderLine(target *FrameBuffers, start, end mgl.Vec2, c color.RGBA, z float64, depthTest bool) {
+	direction := end.Sub(start)
+	steps := max(int(math.Ceil(math.Max(math.Abs(direction.X()), math.Abs(direction.Y())))), 1)
+	for i := 0; i <= steps; i++ {
+		point := start.Add(direction.Mul(float64(i) / float64(steps)))
+		x, y := int(math.Floor(point.X())), int(math.Floor(point.Y()))
+		if x < 0 || y < 0 || x >= target.Depth.Width || y >= target.Depth.Height {
+			continue
+		}
+		if depthTest && z >= target.Depth.Values[target.Depth.Index(x, y)] {
+			continue
+		}
+		blendPixel(target.Color, x, y, c)
+	}
+}
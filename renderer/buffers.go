@@ -0,0 +1,277 @@
+package renderer
+
+import (
+	mgl "github.com/go-gl/mathgl/mgl64"
+	. "github.com/virus-rpi/ThreeDView/types"
+	"image"
+	"image/color"
+	"math"
+	"runtime"
+	"sync"
+)
+
+// DepthBuffer stores the depth of every pixel in one contiguous row-major slice
+type DepthBuffer struct {
+	Width  int
+	Height int
+	Values []float64  // The depth of pixel (x, y) is at y*Width+x. Smaller values are closer, it is +Inf where nothing was drawn
+	Range  DepthRange // How the values relate to the distance from the camera
+	Layers []int32    // The layer of the material of the face in each pixel, which decides between faces at the same depth. Empty if all faces are in layer 0
+}
+
+// Index returns the position of a pixel in Values
+func (buffer *DepthBuffer) Index(x, y int) int {
+	return y*buffer.Width + x
+}
+
+// At returns the depth of a pixel or +Inf if the pixel is outside the buffer
+func (buffer *DepthBuffer) At(x, y int) float64 {
+	if x < 0 || y < 0 || x >= buffer.Width || y >= buffer.Height {
+		return math.Inf(1)
+	}
+	return buffer.Values[y*buffer.Width+x]
+}
+
+// ViewDepth returns the distance of the surface in a pixel in front of the camera along its view direction (the clip space W),
+// or +Inf if nothing was drawn or the pixel is outside the buffer
+func (buffer *DepthBuffer) ViewDepth(x, y int) float64 {
+	return buffer.Range.ViewDepth(buffer.At(x, y))
+}
+
+// perspectiveDepth returns the depth a standard projection with the default near plane and without a far plane would store
+// at an index, from -1 at the default near plane to 1 infinitely far away. It only depends on the view depth, so passes
+// that look at the distribution of the depth, like the edge detection, look the same in every depth mode and with every near and far plane
+func (buffer *DepthBuffer) perspectiveDepth(i int) float64 {
+	depth := buffer.Values[i]
+	if math.IsInf(depth, 0) {
+		return depth
+	}
+	return 1 - 2*float64(DefaultNear)/buffer.Range.ViewDepth(depth)
+}
+
+// coplanarTolerance is the difference of the distance relative to it below which two faces count as being at the same depth
+const coplanarTolerance = 1e-6
+
+// depthTest returns whether a face with the depth and layer is in front of the surface at an index. If both are in
+// different layers and their distances differ by at most the tolerance relative to the distance, the higher layer is in front
+func (buffer *DepthBuffer) depthTest(i int, depth float64, layer int32, tolerance float64) bool {
+	current := buffer.Values[i]
+	if len(buffer.Layers) == 0 || buffer.Layers[i] == layer || math.IsInf(current, 1) {
+		return depth < current
+	}
+	viewDepth, currentViewDepth := buffer.Range.ViewDepth(depth), buffer.Range.ViewDepth(current)
+	if math.Abs(viewDepth-currentViewDepth) <= tolerance*currentViewDepth {
+		return layer > buffer.Layers[i]
+	}
+	return depth < current
+}
+
+// resize changes the size of the buffer. Memory is only reallocated if the buffer grows
+func (buffer *DepthBuffer) resize(width, height int) {
+	buffer.Width, buffer.Height = width, height
+	if cap(buffer.Values) < width*height {
+		buffer.Values = make([]float64, width*height)
+	}
+	buffer.Values = buffer.Values[:width*height]
+}
+
+// useLayers sets up the layers of all pixels in layer 0 if the faces drawn into the buffer are in different layers,
+// otherwise the buffer has no layers. Call it after resize
+func (buffer *DepthBuffer) useLayers(layered bool) {
+	if !layered {
+		buffer.Layers = buffer.Layers[:0]
+		return
+	}
+	if cap(buffer.Layers) < len(buffer.Values) {
+		buffer.Layers = make([]int32, len(buffer.Values))
+	}
+	buffer.Layers = buffer.Layers[:len(buffer.Values)]
+	clear(buffer.Layers)
+}
+
+// setLayer records the layer of the surface at an index if the buffer has layers
+func (buffer *DepthBuffer) setLayer(i int, layer int32) {
+	if len(buffer.Layers) > 0 {
+		buffer.Layers[i] = layer
+	}
+}
+
+// clear sets the depth of every pixel to +Inf
+func (buffer *DepthBuffer) clear() {
+	if len(buffer.Values) == 0 {
+		return
+	}
+	buffer.Values[0] = math.Inf(1)
+	for filled := 1; filled < len(buffer.Values); filled *= 2 {
+		copy(buffer.Values[filled:], buffer.Values[:filled])
+	}
+}
+
+// IDBuffer stores the ID of the face that is visible in every pixel in one contiguous row-major slice
+type IDBuffer struct {
+	Width  int
+	Height int
+	Values []int32 // The ID of pixel (x, y) is at y*Width+x. It is 0 where no pickable face was drawn
+}
+
+// Index returns the position of a pixel in Values
+func (buffer *IDBuffer) Index(x, y int) int {
+	return y*buffer.Width + x
+}
+
+// At returns the ID of a pixel or 0 if the pixel is outside the buffer
+func (buffer *IDBuffer) At(x, y int) int32 {
+	if x < 0 || y < 0 || x >= buffer.Width || y >= buffer.Height {
+		return 0
+	}
+	return buffer.Values[y*buffer.Width+x]
+}
+
+// resize changes the size of the buffer. Memory is only reallocated if the buffer grows
+func (buffer *IDBuffer) resize(width, height int) {
+	buffer.Width, buffer.Height = width, height
+	if cap(buffer.Values) < width*height {
+		buffer.Values = make([]int32, width*height)
+	}
+	buffer.Values = buffer.Values[:width*height]
+}
+
+// clear sets the ID of every pixel to 0
+func (buffer *IDBuffer) clear() {
+	clear(buffer.Values)
+}
+
+// NormalBuffer stores the world space normal of the surface visible in every pixel in one contiguous row-major slice.
+// Normals point towards the camera
+type NormalBuffer struct {
+	Width  int
+	Height int
+	Values []mgl.Vec3 // The normal of pixel (x, y) is at y*Width+x. It is the zero vector where nothing was drawn
+}
+
+// Index returns the position of a pixel in Values
+func (buffer *NormalBuffer) Index(x, y int) int {
+	return y*buffer.Width + x
+}
+
+// At returns the normal of a pixel or the zero vector if the pixel is outside the buffer
+func (buffer *NormalBuffer) At(x, y int) mgl.Vec3 {
+	if x < 0 || y < 0 || x >= buffer.Width || y >= buffer.Height {
+		return mgl.Vec3{}
+	}
+	return buffer.Values[y*buffer.Width+x]
+}
+
+// resize changes the size of the buffer. Memory is only reallocated if the buffer grows
+func (buffer *NormalBuffer) resize(width, height int) {
+	buffer.Width, buffer.Height = width, height
+	if cap(buffer.Values) < width*height {
+		buffer.Values = make([]mgl.Vec3, width*height)
+	}
+	buffer.Values = buffer.Values[:width*height]
+}
+
+// clear sets the normal of every pixel to the zero vector
+func (buffer *NormalBuffer) clear() {
+	clear(buffer.Values)
+}
+
+// resizeImage returns an image of the given size, reusing img if it already has that size
+func resizeImage(img *image.RGBA, width, height int) *image.RGBA {
+	if img != nil && img.Bounds().Dx() == width && img.Bounds().Dy() == height {
+		return img
+	}
+	return image.NewRGBA(image.Rect(0, 0, width, height))
+}
+
+// fillImage sets every pixel of the image to one color without allocating
+func fillImage(img *image.RGBA, c color.Color) {
+	if len(img.Pix) == 0 {
+		return
+	}
+	rgba := color.RGBAModel.Convert(c).(color.RGBA)
+	img.Pix[0], img.Pix[1], img.Pix[2], img.Pix[3] = rgba.R, rgba.G, rgba.B, rgba.A
+	for filled := 4; filled < len(img.Pix); filled *= 2 {
+		copy(img.Pix[filled:], img.Pix[:filled])
+	}
+}
+
+// setPixel writes a color directly into the pixel data of the image. The pixel has to be inside the image
+func setPixel(img *image.RGBA, x, y int, c color.RGBA) {
+	i := y*img.Stride + x*4
+	img.Pix[i], img.Pix[i+1], img.Pix[i+2], img.Pix[i+3] = c.R, c.G, c.B, c.A
+}
+
+// pixelAt reads a color directly from the pixel data of the image. The pixel has to be inside the image
+func pixelAt(img *image.RGBA, x, y int) color.RGBA {
+	i := y*img.Stride + x*4
+	return color.RGBA{R: img.Pix[i], G: img.Pix[i+1], B: img.Pix[i+2], A: img.Pix[i+3]}
+}
+
+// depthHistogramBins is the resolution used to find depth quantiles
+const depthHistogramBins = 1024
+
+// depthRange returns the transformed perspective depth at the low and high quantile (0 to 1) of all drawn pixels.
+// A histogram is used instead of sorting so no memory is allocated. Returns false if nothing was drawn
+func depthRange(depth *DepthBuffer, transform func(float64) float64, low, high float64) (float64, float64, bool) {
+	minValue, maxValue := math.Inf(1), math.Inf(-1)
+	count := 0
+	for i := range depth.Values {
+		z := depth.perspectiveDepth(i)
+		if math.IsInf(z, 0) || z <= 0 {
+			continue
+		}
+		value := transform(z)
+		minValue = math.Min(minValue, value)
+		maxValue = math.Max(maxValue, value)
+		count++
+	}
+	if count == 0 {
+		return 0, 0, false
+	}
+	if minValue == maxValue {
+		return minValue, maxValue, true
+	}
+
+	var histogram [depthHistogramBins]int
+	scale := (depthHistogramBins - 1) / (maxValue - minValue)
+	for i := range depth.Values {
+		z := depth.perspectiveDepth(i)
+		if math.IsInf(z, 0) || z <= 0 {
+			continue
+		}
+		histogram[int((transform(z)-minValue)*scale)]++
+	}
+
+	quantile := func(q float64) float64 {
+		target := int(q * float64(count))
+		seen := 0
+		for bin, n := range histogram {
+			seen += n
+			if seen > target {
+				return minValue + float64(bin)/scale
+			}
+		}
+		return maxValue
+	}
+	return quantile(low), quantile(high), true
+}
+
+// parallelRows splits the rows from 0 to height into one band per CPU and processes the bands concurrently.
+// process is called with the first row of a band and the row after its last one
+func parallelRows(height int, process func(minY, maxY int)) {
+	bands := min(runtime.NumCPU(), height)
+	if bands <= 1 {
+		process(0, height)
+		return
+	}
+	wg := sync.WaitGroup{}
+	for band := 0; band < bands; band++ {
+		wg.Add(1)
+		go func(minY, maxY int) {
+			defer wg.Done()
+			process(minY, maxY)
+		}(band*height/bands, (band+1)*height/bands)
+	}
+	wg.Wait()
+}
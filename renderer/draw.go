@@ -3,135 +3,279 @@ package renderer
 import (
 	mgl "github.com/go-gl/mathgl/mgl64"
 	"github.com/virus-rpi/ThreeDView/object"
+	"github.com/virus-rpi/ThreeDView/texture"
 	. "github.com/virus-rpi/ThreeDView/types"
 	"image"
 	"image/color"
 	"math"
 )
 
-func drawFilledTriangle(img *image.RGBA, face object.ProjectedFaceData, zBuffer [][]float64, useTexture bool) {
-	p := face.Face
-	z := face.Z
-	fill := face.Color
-	textureImg := face.TextureImage
+// subPixelBits is the number of fractional bits vertex positions are snapped to before rasterizing
+const subPixelBits = 8
+
+// snapTolerance is the distance in pixels between the depths of faces in the same plane that still count as the same
+// depth, a multiple of the error of snapping their vertices to the subpixel grid
+const snapTolerance = 4.0 / (1 << subPixelBits)
+
+// drawFilledTriangle rasterizes the part of a projected face inside the clip rectangle.
+// Pixels are sampled at their centers with edge functions on snapped fixed point positions and a top-left fill rule,
+// so triangles that share an edge cover every pixel along it exactly once.
+// The depth is moved by the depth bias of the face, and faces at the same depth are ordered by the layer of their material.
+// If blend is true, the face is blended with the color buffer and doesn't write depth, layer, ID or normal.
+// The ID and normal buffer of the target are only written if they aren't nil
+// If the target has no color buffer only the depth, ID and normal are written, which is used to render shadow maps and
+// faces without colors. The alpha cutoff of the material applies to them too, so cutouts don't cast solid shadows
+func drawFilledTriangle(target *FrameBuffers, face *object.ProjectedFaceData, useTexture bool, light *lighting, blend bool, clip image.Rectangle) {
+	img, zBuffer, ids, normals := target.Color, target.Depth, target.IDs, target.Normals
+	clip = clip.Intersect(image.Rect(0, 0, zBuffer.Width, zBuffer.Height))
+	if img != nil {
+		clip = clip.Intersect(img.Bounds())
+	}
+	fill := color.RGBA{A: 255}
+	if face.Color != nil {
+		fill = color.RGBAModel.Convert(face.Color).(color.RGBA)
+	}
+	material := face.Material
+	if material == nil {
+		material = DefaultMaterial
+	}
 	texCoords := face.TexCoords
-	v := [3]struct {
-		p mgl.Vec2
-		z float64
-		t mgl.Vec2
-	}{{p[0], z[0], texCoords[0]}, {p[1], z[1], texCoords[1]}, {p[2], z[2], texCoords[2]}}
+	layer := int32(material.Layer)
+	// Snapping the vertices changes the depth by up to the depth slope times the snapped distance, which two faces in the
+	// same plane but with different vertices don't share
+	coplanar := coplanarTolerance + depthSlope(face.Face, face.W)*snapTolerance
+
+	const one = 1 << subPixelBits
+	var vx, vy [3]int64
+	for i, point := range face.Face {
+		vx[i] = int64(math.Round(point.X() * one))
+		vy[i] = int64(math.Round(point.Y() * one))
+	}
 
-	if v[1].p.Y() < v[0].p.Y() {
-		v[0], v[1] = v[1], v[0]
+	// edge i is the edge opposite to vertex i, its edge function is the barycentric weight of vertex i
+	edgeFunction := func(a, b int, px, py int64) int64 {
+		return (vx[b]-vx[a])*(py-vy[a]) - (vy[b]-vy[a])*(px-vx[a])
 	}
-	if v[2].p.Y() < v[0].p.Y() {
-		v[0], v[2] = v[2], v[0]
+	area := edgeFunction(0, 1, vx[2], vy[2])
+	if area == 0 {
+		return
 	}
-	if v[2].p.Y() < v[1].p.Y() {
-		v[1], v[2] = v[2], v[1]
+	edges := [3][2]int{{1, 2}, {2, 0}, {0, 1}}
+	if area < 0 {
+		// Flip the orientation so all edge functions are positive inside
+		edges = [3][2]int{{2, 1}, {0, 2}, {1, 0}}
+		area = -area
 	}
 
-	interpolate := func(y, y1, y2, x1, x2, z1, z2 float64, t1, t2 mgl.Vec2) (Pixel, float64, mgl.Vec2) {
-		if y1 == y2 {
-			return Pixel(x1), z1, t1
+	// Pixels exactly on an edge only belong to the triangle if it is a top or left edge
+	var bias [3]int64
+	for i, edge := range edges {
+		dx, dy := vx[edge[1]]-vx[edge[0]], vy[edge[1]]-vy[edge[0]]
+		if !(dy < 0 || (dy == 0 && dx > 0)) {
+			bias[i] = -1
 		}
-		t := (y - y1) / (y2 - y1)
-		return Pixel(x1 + (x2-x1)*t),
-			z1 + (z2-z1)*t,
-			mgl.Vec2{t1.X() + (t2.X()-t1.X())*t, t1.Y() + (t2.Y()-t1.Y())*t}
 	}
 
-	getTextureColor := func(texImg image.Image, texCoord mgl.Vec2) color.Color {
-		if texImg == nil {
-			return fill
-		}
+	minX := max(int(math.Ceil(float64(min(vx[0], vx[1], vx[2]))/one-0.5)), clip.Min.X)
+	maxX := min(int(math.Floor(float64(max(vx[0], vx[1], vx[2]))/one-0.5)), clip.Max.X-1)
+	minY := max(int(math.Ceil(float64(min(vy[0], vy[1], vy[2]))/one-0.5)), clip.Min.Y)
+	maxY := min(int(math.Floor(float64(max(vy[0], vy[1], vy[2]))/one-0.5)), clip.Max.Y-1)
+	if minX > maxX || minY > maxY {
+		return
+	}
 
-		bounds := texImg.Bounds()
-		width := bounds.Dx()
-		height := bounds.Dy()
+	// Edge function values at the first pixel center and their change per pixel step
+	startX, startY := int64(minX)*one+one/2, int64(minY)*one+one/2
+	var rowValues, stepX, stepY [3]int64
+	for i, edge := range edges {
+		rowValues[i] = edgeFunction(edge[0], edge[1], startX, startY)
+		stepX[i] = -(vy[edge[1]] - vy[edge[0]]) * one
+		stepY[i] = (vx[edge[1]] - vx[edge[0]]) * one
+	}
+	inverseArea := 1 / float64(area)
+	weightStepX := mgl.Vec3{float64(stepX[0]) * inverseArea, float64(stepX[1]) * inverseArea, float64(stepX[2]) * inverseArea}
+	weightStepY := mgl.Vec3{float64(stepY[0]) * inverseArea, float64(stepY[1]) * inverseArea, float64(stepY[2]) * inverseArea}
 
-		x := int(math.Floor(texCoord.X() * float64(width-1)))
-		y := int(math.Floor((1.0 - texCoord.Y()) * float64(height-1))) // Flip Y coordinate
+	var tex *texture.Texture
+	if useTexture && face.TextureImage != nil {
+		tex = texture.FromImage(face.TextureImage)
+	}
 
-		if x < 0 {
-			x = 0
-		} else if x >= width {
-			x = width - 1
+	// surfaceColor returns the unlit color of a pixel from its barycentric weights in screen space
+	surfaceColor := func(screenWeights mgl.Vec3) color.RGBA {
+		weights := perspectiveWeights(screenWeights, face.W)
+		c := fill
+		if face.HasColors {
+			c = interpolateColor(face.Colors, weights)
 		}
-		if y < 0 {
-			y = 0
-		} else if y >= height {
-			y = height - 1
+		// Use texture if available and enabled
+		if tex != nil {
+			texCoord := interpolateVec2(texCoords, weights)
+			lod := 0.0
+			if tex.Mipmaps() {
+				// Texture coordinate derivatives from the neighbouring pixels select the mipmap level
+				texCoordX := interpolateVec2(texCoords, perspectiveWeights(screenWeights.Add(weightStepX), face.W))
+				texCoordY := interpolateVec2(texCoords, perspectiveWeights(screenWeights.Add(weightStepY), face.W))
+				lod = tex.LevelOfDetail(texCoordX.Sub(texCoord), texCoordY.Sub(texCoord))
+			}
+			c = tex.Sample(texCoord, lod)
 		}
-
-		return texImg.At(x, y)
+		if material.Opacity < 1 {
+			c = scaleColor(c, math.Max(material.Opacity, 0))
+		}
+		return c
 	}
-
-	for yf := math.Ceil(v[0].p.Y()); yf <= v[1].p.Y(); yf++ {
-		x1, z1, t1 := interpolate(yf, v[0].p.Y(), v[1].p.Y(), v[0].p.X(), v[1].p.X(), v[0].z, v[1].z, v[0].t, v[1].t)
-		x2, z2, t2 := interpolate(yf, v[0].p.Y(), v[2].p.Y(), v[0].p.X(), v[2].p.X(), v[0].z, v[2].z, v[0].t, v[2].t)
-		if x1 > x2 {
-			x1, x2, z1, z2, t1, t2 = x2, x1, z2, z1, t2, t1
+	// passesAlphaTest returns whether a pixel with the alpha is kept by the alpha cutoff of the material
+	passesAlphaTest := func(alpha uint8) bool {
+		return material.AlphaCutoff <= 0 || float64(alpha) >= material.AlphaCutoff*255
+	}
+	// shadePixel returns the lit color of a pixel from its barycentric weights in screen space
+	shadePixel := func(screenWeights mgl.Vec3) color.RGBA {
+		c := surfaceColor(screenWeights)
+		if !face.Lit {
+			return c
 		}
-		for x := int(math.Ceil(float64(x1))); float64(x) <= float64(x2); x++ {
-			if x >= 0 && x < img.Bounds().Dx() && int(yf) >= 0 && int(yf) < img.Bounds().Dy() {
-				t := 0.0
-				if x2 != x1 {
-					t = float64(x-int(x1)) / float64(x2-x1)
-				}
-				z := z1 + (z2-z1)*t
-				texCoord := mgl.Vec2{t1.X() + (t2.X()-t1.X())*t, t1.Y() + (t2.Y()-t1.Y())*t}
-
-				if x >= len(zBuffer) || int(yf) >= len(zBuffer[x]) {
-					continue
-				}
-				if z < zBuffer[x][int(yf)] {
-					zBuffer[x][int(yf)] = z
-
-					// Use texture if available and enabled
-					if useTexture && textureImg != nil {
-						img.Set(x, int(yf), getTextureColor(textureImg, texCoord))
-					} else {
-						img.Set(x, int(yf), fill)
-					}
-				}
+		weights := perspectiveWeights(screenWeights, face.W)
+		switch face.Shading {
+		case ShadingGouraud:
+			return applyLight(c, interpolateVec3(face.Diffuse, weights), interpolateVec3(face.Specular, weights))
+		case ShadingPhong:
+			if light == nil {
+				return c
 			}
+			diffuse, specular := light.shade(interpolateVec3(face.Positions, weights), interpolateVec3(face.Normals, weights), face.Material)
+			return applyLight(c, diffuse, specular)
+		default:
+			return applyLight(c, face.Diffuse[0], face.Specular[0])
 		}
 	}
 
-	for yf := v[1].p.Y(); yf <= v[2].p.Y(); yf++ {
-		x1, z1, t1 := interpolate(yf, v[1].p.Y(), v[2].p.Y(), v[1].p.X(), v[2].p.X(), v[1].z, v[2].z, v[1].t, v[2].t)
-		x2, z2, t2 := interpolate(yf, v[0].p.Y(), v[2].p.Y(), v[0].p.X(), v[2].p.X(), v[0].z, v[2].z, v[0].t, v[2].t)
-		if x1 > x2 {
-			x1, x2, z1, z2, t1, t2 = x2, x1, z2, z1, t2, t1
+	// writeSurface records the face as the closest surface in a pixel, with its depth, layer, ID and normal
+	writeSurface := func(depthIndex int, z float64, screenWeights mgl.Vec3) {
+		zBuffer.Values[depthIndex] = z
+		zBuffer.setLayer(depthIndex, layer)
+		if ids != nil {
+			ids.Values[depthIndex] = face.ID
 		}
-		for x := int(math.Ceil(float64(x1))); float64(x) <= float64(x2); x++ {
-			if x >= 0 && x < img.Bounds().Dx() && int(yf) >= 0 && int(yf) < img.Bounds().Dy() {
-				t := 0.0
-				if x2 != x1 {
-					t = float64(x-int(x1)) / float64(x2-x1)
-				}
-				z := z1 + (z2-z1)*t
-				texCoord := mgl.Vec2{t1.X() + (t2.X()-t1.X())*t, t1.Y() + (t2.Y()-t1.Y())*t}
+		if normals != nil {
+			if normal := interpolateVec3(face.Normals, perspectiveWeights(screenWeights, face.W)); normal.Len() > 0 {
+				normals.Values[depthIndex] = normal.Normalize()
+			}
+		}
+	}
 
-				if x >= len(zBuffer) || int(yf) >= len(zBuffer[x]) {
-					continue
+	for y := minY; y <= maxY; y++ {
+		values := rowValues
+		for x := minX; x <= maxX; x++ {
+			if values[0]+bias[0] >= 0 && values[1]+bias[1] >= 0 && values[2]+bias[2] >= 0 {
+				screenWeights := mgl.Vec3{float64(values[0]) * inverseArea, float64(values[1]) * inverseArea, float64(values[2]) * inverseArea}
+				// Depth is linear in screen space so it can be interpolated directly
+				z := face.Z[0]*screenWeights[0] + face.Z[1]*screenWeights[1] + face.Z[2]*screenWeights[2]
+				if zBuffer.Range.Mode == DepthLogarithmic {
+					// Logarithmic depth isn't linear in screen space, it is calculated from the perspective correct W of the pixel
+					z = zBuffer.Range.Depth(z, 1/(screenWeights[0]/face.W[0]+screenWeights[1]/face.W[1]+screenWeights[2]/face.W[2]))
 				}
-				if z < zBuffer[x][int(yf)] {
-					zBuffer[x][int(yf)] = z
-
-					if useTexture && textureImg != nil {
-						img.Set(x, int(yf), getTextureColor(textureImg, texCoord))
-					} else {
-						img.Set(x, int(yf), fill)
+				if face.DepthBias != 0 {
+					z = zBuffer.Range.Offset(z, face.DepthBias)
+				}
+				depthIndex := y*zBuffer.Width + x
+				visible := zBuffer.depthTest(depthIndex, z, layer, coplanar)
+				if visible && img == nil {
+					// Without colors only the alpha test needs the color of the pixel
+					if material.AlphaCutoff <= 0 || passesAlphaTest(surfaceColor(screenWeights).A) {
+						writeSurface(depthIndex, z, screenWeights)
+					}
+				} else if visible {
+					c := shadePixel(screenWeights)
+					if passesAlphaTest(c.A) {
+						if blend {
+							blendPixel(img, x, y, c)
+						} else {
+							writeSurface(depthIndex, z, screenWeights)
+							setPixel(img, x, y, c)
+						}
 					}
 				}
 			}
+			values[0] += stepX[0]
+			values[1] += stepX[1]
+			values[2] += stepX[2]
 		}
+		rowValues[0] += stepY[0]
+		rowValues[1] += stepY[1]
+		rowValues[2] += stepY[2]
+	}
+}
+
+// blendPixel blends a premultiplied color over the pixel of the image
+func blendPixel(img *image.RGBA, x, y int, c color.RGBA) {
+	i := y*img.Stride + x*4
+	inverseAlpha := 255 - uint32(c.A)
+	img.Pix[i] = uint8(uint32(c.R) + uint32(img.Pix[i])*inverseAlpha/255)
+	img.Pix[i+1] = uint8(uint32(c.G) + uint32(img.Pix[i+1])*inverseAlpha/255)
+	img.Pix[i+2] = uint8(uint32(c.B) + uint32(img.Pix[i+2])*inverseAlpha/255)
+	img.Pix[i+3] = uint8(uint32(c.A) + uint32(img.Pix[i+3])*inverseAlpha/255)
+}
+
+// scaleColor multiplies all channels of a premultiplied color with a factor between 0 and 1
+func scaleColor(c color.RGBA, factor float64) color.RGBA {
+	return color.RGBA{
+		R: uint8(float64(c.R) * factor),
+		G: uint8(float64(c.G) * factor),
+		B: uint8(float64(c.B) * factor),
+		A: uint8(float64(c.A) * factor),
 	}
 }
 
-func drawEdge(img *image.RGBA, p1 mgl.Vec2, z1 float64, p2 mgl.Vec2, z2 float64, c color.Color, zBuffer [][]float64) {
+// depthSlope returns the largest change of the distance from the camera per pixel relative to the distance at the center
+// of a projected triangle, which is large for faces seen at a grazing angle, like the slope of glPolygonOffset
+func depthSlope(points [3]mgl.Vec2, w [3]float64) float64 {
+	// The inverse of W is linear in screen space, so its gradient is the same in the whole triangle
+	p0, p1, p2 := points[0], points[1], points[2]
+	f0, f1, f2 := 1/w[0], 1/w[1], 1/w[2]
+	area := (p1.X()-p0.X())*(p2.Y()-p0.Y()) - (p2.X()-p0.X())*(p1.Y()-p0.Y())
+	if area == 0 {
+		return 0
+	}
+	gradientX := ((f1-f0)*(p2.Y()-p0.Y()) - (f2-f0)*(p1.Y()-p0.Y())) / area
+	gradientY := ((f2-f0)*(p1.X()-p0.X()) - (f1-f0)*(p2.X()-p0.X())) / area
+	return math.Max(math.Abs(gradientX), math.Abs(gradientY)) / ((f0 + f1 + f2) / 3)
+}
+
+// interpolateColor blends the premultiplied colors of the vertices of a face with barycentric weights
+func interpolateColor(colors [3]color.RGBA, weights mgl.Vec3) color.RGBA {
+	channel := func(a, b, c uint8) uint8 {
+		return uint8(math.Min(math.Max(float64(a)*weights[0]+float64(b)*weights[1]+float64(c)*weights[2]+0.5, 0), 255))
+	}
+	return color.RGBA{
+		R: channel(colors[0].R, colors[1].R, colors[2].R),
+		G: channel(colors[0].G, colors[1].G, colors[2].G),
+		B: channel(colors[0].B, colors[1].B, colors[2].B),
+		A: channel(colors[0].A, colors[1].A, colors[2].A),
+	}
+}
+
+// perspectiveWeights corrects barycentric weights from screen space so attributes are interpolated linearly in 3D space.
+// Attributes divided by w are linear in screen space, so the weights are divided by w and normalized again
+func perspectiveWeights(weights mgl.Vec3, w [3]float64) mgl.Vec3 {
+	if w[0] <= 0 || w[1] <= 0 || w[2] <= 0 {
+		return weights
+	}
+	corrected := mgl.Vec3{weights[0] / w[0], weights[1] / w[1], weights[2] / w[2]}
+	sum := corrected[0] + corrected[1] + corrected[2]
+	if sum == 0 {
+		return weights
+	}
+	return corrected.Mul(1 / sum)
+}
+
+// interpolateVec2 interpolates three values with barycentric weights
+func interpolateVec2(values [3]mgl.Vec2, weights mgl.Vec3) mgl.Vec2 {
+	return values[0].Mul(weights[0]).Add(values[1].Mul(weights[1])).Add(values[2].Mul(weights[2]))
+}
+
+func drawEdge(img *image.RGBA, p1 mgl.Vec2, z1 float64, p2 mgl.Vec2, z2 float64, c color.Color, zBuffer *DepthBuffer) {
+	rgba := color.RGBAModel.Convert(c).(color.RGBA)
 	x0, y0 := int(math.Round(p1.X())), int(math.Round(p1.Y()))
 	x1, y1 := int(math.Round(p2.X())), int(math.Round(p2.Y()))
 	dx, dy := int(math.Abs(float64(x1-x0))), int(math.Abs(float64(y1-y0)))
@@ -151,11 +295,11 @@ func drawEdge(img *image.RGBA, p1 mgl.Vec2, z1 float64, p2 mgl.Vec2, z2 float64,
 				t = math.Hypot(float64(x0-int(math.Round(p1.X()))), float64(y0-int(math.Round(p1.Y())))) / total
 			}
 			z := z1 + (z2-z1)*t
-			if x0 >= len(zBuffer) || y0 >= len(zBuffer[x0]) {
+			if x0 >= zBuffer.Width || y0 >= zBuffer.Height {
 				return
 			}
-			if z <= zBuffer[x0][y0] {
-				img.Set(x0, y0, c)
+			if z <= zBuffer.Values[zBuffer.Index(x0, y0)] {
+				setPixel(img, x0, y0, rgba)
 			}
 		}
 		if x0 == x1 && y0 == y1 {
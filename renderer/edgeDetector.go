@@ -1,50 +1,28 @@
 package renderer
 
 import (
+	mgl "github.com/go-gl/mathgl/mgl64"
+	. "github.com/virus-rpi/ThreeDView/types"
 	"math"
-	"sort"
 )
 
-func detectZBufferEdges(zBuffer [][]float64, baseThreshold, depthModulation, grazingAnglePower, grazingAngleHardness float64) [][]bool {
-	w, h := len(zBuffer), len(zBuffer[0])
-	mask := make([][]bool, w)
-	for i := range mask {
-		mask[i] = make([]bool, h)
+// detectZBufferEdges marks pixels where the depth changes sharply in mask. normZ is scratch memory of the same size as the depth buffer
+func detectZBufferEdges(depth *DepthBuffer, mask []bool, normZ []float64, baseThreshold, depthModulation, grazingAnglePower, grazingAngleHardness float64) {
+	w, h := depth.Width, depth.Height
+	minZ, maxZ, ok := depthRange(depth, math.Log, 0.02, 0.98)
+	if !ok {
+		return
 	}
-	var logzVals []float64
-	for x := 0; x < w; x++ {
-		for y := 0; y < h; y++ {
-			z := zBuffer[x][y]
-			if !math.IsInf(z, 1) && !math.IsInf(z, -1) && z > 0 {
-				logzVals = append(logzVals, math.Log(z))
-			}
-		}
-	}
-	if len(logzVals) == 0 {
-		return mask
-	}
-	sort.Float64s(logzVals)
-	lowIdx := int(0.02 * float64(len(logzVals)))
-	highIdx := int(0.98 * float64(len(logzVals)))
-	if highIdx <= lowIdx {
-		lowIdx = 0
-		highIdx = len(logzVals) - 1
-	}
-	minZ, maxZ := logzVals[lowIdx], logzVals[highIdx]
 	if minZ == maxZ {
 		minZ, maxZ = 0, 1
 	}
-	normZ := make([][]float64, w)
-	for x := 0; x < w; x++ {
-		normZ[x] = make([]float64, h)
-		for y := 0; y < h; y++ {
-			z := zBuffer[x][y]
-			logz := maxZ
-			if !math.IsInf(z, 1) && !math.IsInf(z, -1) && z > 0 {
-				logz = math.Log(z)
-			}
-			normZ[x][y] = (logz - minZ) / (maxZ - minZ)
+	for i := range depth.Values {
+		z := depth.perspectiveDepth(i)
+		logz := maxZ
+		if !math.IsInf(z, 1) && !math.IsInf(z, -1) && z > 0 {
+			logz = math.Log(z)
 		}
+		normZ[i] = (logz - minZ) / (maxZ - minZ)
 	}
 	gx := [3][3]float64{{-1, 0, 1}, {-2, 0, 2}, {-1, 0, 1}}
 	gy := [3][3]float64{{-1, -2, -1}, {0, 0, 0}, {1, 2, 1}}
@@ -53,13 +31,13 @@ func detectZBufferEdges(zBuffer [][]float64, baseThreshold, depthModulation, gra
 			var sx, sy float64
 			for i := -1; i <= 1; i++ {
 				for j := -1; j <= 1; j++ {
-					z := normZ[x+i][y+j]
+					z := normZ[(y+j)*w+x+i]
 					sx += gx[i+1][j+1] * z
 					sy += gy[i+1][j+1] * z
 				}
 			}
 
-			z := zBuffer[x][y]
+			z := depth.perspectiveDepth(y*w + x)
 			threshold := baseThreshold
 			if !math.IsInf(z, 1) && !math.IsInf(z, -1) && z > 0 {
 				threshold *= 1.0 + depthModulation*z
@@ -81,9 +59,74 @@ func detectZBufferEdges(zBuffer [][]float64, baseThreshold, depthModulation, gra
 			}
 
 			if gradientMagnitude > threshold {
-				mask[x][y] = true
+				mask[y*w+x] = true
+			}
+		}
+	}
+}
+
+// detectNormalEdges marks pixels where the normal differs from a neighbouring pixel by more than the angle
+// with the given cosine in mask. Of two neighbouring pixels the one closer to the camera is marked
+func detectNormalEdges(normals *NormalBuffer, depth *DepthBuffer, mask []bool, cosThreshold float64) {
+	w, h := normals.Width, normals.Height
+	compare := func(i, j int) {
+		a, b := normals.Values[i], normals.Values[j]
+		if a == (mgl.Vec3{}) || b == (mgl.Vec3{}) || a.Dot(b) >= cosThreshold {
+			return
+		}
+		if depth.Values[i] <= depth.Values[j] {
+			mask[i] = true
+		} else {
+			mask[j] = true
+		}
+	}
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			i := y*w + x
+			if x+1 < w {
+				compare(i, i+1)
+			}
+			if y+1 < h {
+				compare(i, i+w)
+			}
+		}
+	}
+}
+
+// detectObjectEdges marks pixels where a different object or the background is visible in a neighbouring pixel in mask.
+// Of two neighbouring pixels the one closer to the camera is marked
+func detectObjectEdges(buffers *FrameBuffers, mask []bool) {
+	ids, depth := buffers.IDs, buffers.Depth
+	w, h := ids.Width, ids.Height
+	objectAt := func(i int) ObjectInterface {
+		if face := buffers.Face(ids.Values[i]); face != nil {
+			return face.Object
+		}
+		return nil
+	}
+	compare := func(i, j int) {
+		if ids.Values[i] == ids.Values[j] {
+			return
+		}
+		a, b := objectAt(i), objectAt(j)
+		if a == b {
+			return
+		}
+		if b == nil || (a != nil && depth.Values[i] <= depth.Values[j]) {
+			mask[i] = true
+		} else {
+			mask[j] = true
+		}
+	}
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			i := y*w + x
+			if x+1 < w {
+				compare(i, i+1)
+			}
+			if y+1 < h {
+				compare(i, i+w)
 			}
 		}
 	}
-	return mask
 }
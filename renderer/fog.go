@@ -0,0 +1,85 @@
+package renderer
+
+import (
+	. "github.com/virus-rpi/ThreeDView/types"
+	"image/color"
+	"math"
+)
+
+// fogPass blends pixels towards the fog color depending on their distance from the camera and their height,
+// configured by the fog settings of the widget
+type fogPass struct{}
+
+func (pass *fogPass) Apply(buffers *FrameBuffers) {
+	settings := buffers.Widget.GetFog()
+	fogColor := settings.Color
+	if fogColor == nil {
+		fogColor = buffers.Widget.GetBackgroundColor()
+	}
+	if fogColor == nil {
+		fogColor = color.Transparent
+	}
+	fog := color.RGBAModel.Convert(fogColor).(color.RGBA)
+	cameraPosition := buffers.Widget.GetCamera().Position()
+	// Without an own color the fog fades objects into the background behind them
+	background := buffers.Widget.GetBackground()
+	if settings.Color != nil {
+		background = nil
+	}
+
+	width, height := buffers.Depth.Width, buffers.Depth.Height
+	parallelRows(height, func(minY, maxY int) {
+		for y := minY; y < maxY; y++ {
+			for x := 0; x < width; x++ {
+				position, ok := buffers.WorldPosition(x, y)
+				if !ok {
+					continue
+				}
+				amount := fogAmount(settings, cameraPosition.Y(), position.Y(), position.Sub(cameraPosition).Len())
+				if amount <= 0 {
+					continue
+				}
+				pixelFog := fog
+				if background != nil {
+					pixelFog = background.ColorAt(position.Sub(cameraPosition).Normalize())
+				}
+				setPixel(buffers.Color, x, y, mixColors(pixelAt(buffers.Color, x, y), pixelFog, amount))
+			}
+		}
+	})
+}
+
+// fogAmount returns how much a point at a distance from the camera is hidden by fog, from 0 (clear) to 1 (only fog)
+func fogAmount(settings FogSettings, cameraHeight, pointHeight, distance float64) float64 {
+	visibility := 1.0
+	switch settings.Mode {
+	case FogLinear:
+		if settings.End > settings.Start {
+			visibility = 1 - (distance-float64(settings.Start))/float64(settings.End-settings.Start)
+		} else if distance >= float64(settings.End) {
+			visibility = 0
+		}
+	case FogExponential:
+		visibility = math.Exp(-settings.Density * distance)
+	case FogExponentialSquared:
+		visibility = math.Exp(-math.Pow(settings.Density*distance, 2))
+	}
+	visibility = math.Max(0, math.Min(1, visibility))
+
+	if settings.HeightFog {
+		// The density falls off exponentially with the height, so the fog along the ray from the camera
+		// to the point is the integral of the density over the height change
+		falloff := settings.HeightFogFalloff
+		density := settings.HeightFogDensity * math.Exp(-falloff*(cameraHeight-float64(settings.HeightFogBase)))
+		heightChange := falloff * (pointHeight - cameraHeight)
+		amount := density * distance
+		if math.Abs(heightChange) > 1e-6 {
+			amount *= (1 - math.Exp(-heightChange)) / heightChange
+		}
+		if math.IsNaN(amount) {
+			amount = math.Inf(1)
+		}
+		visibility *= math.Exp(-math.Max(amount, 0))
+	}
+	return 1 - visibility
+}
@@ -0,0 +1,185 @@
+package renderer
+
+import (
+	mgl "github.com/go-gl/mathgl/mgl64"
+	"github.com/virus-rpi/ThreeDView/object"
+	. "github.com/virus-rpi/ThreeDView/types"
+	"image/color"
+	"math"
+)
+
+// lighting holds the lights of one frame and shades surface points with them
+type lighting struct {
+	lights         []LightInterface
+	shadows        []*shadowMap // The shadow map of the light with the same index, nil for lights without shadows
+	ambient        mgl.Vec3
+	cameraPosition mgl.Vec3
+}
+
+// newLighting collects the lights of the widget. Returns nil if lighting is disabled or there are no lights
+func newLighting(widget ThreeDWidgetInterface) *lighting {
+	lights := widget.GetLights()
+	if !widget.GetRenderLighting() || len(lights) == 0 {
+		return nil
+	}
+	ambientColor, ambientIntensity := widget.GetAmbientLight()
+	return &lighting{
+		lights:         append([]LightInterface(nil), lights...),
+		ambient:        ColorToVec3(ambientColor).Mul(ambientIntensity),
+		cameraPosition: widget.GetCamera().Position(),
+	}
+}
+
+// shade returns the light at a point with the given normal in world space.
+// The surface color gets multiplied with diffuse and specular gets added to it.
+// The normal is flipped towards the camera so faces are lit from both sides
+func (l *lighting) shade(point, normal mgl.Vec3, material *Material) (diffuse, specular mgl.Vec3) {
+	if material == nil {
+		material = DefaultMaterial
+	}
+	toCamera := l.cameraPosition.Sub(point)
+	if toCamera.Len() > 0 {
+		toCamera = toCamera.Normalize()
+	}
+	if normal.Len() == 0 || math.IsNaN(normal.X()) {
+		normal = toCamera
+	} else {
+		normal = normal.Normalize()
+	}
+	if normal.Dot(toCamera) < 0 {
+		normal = normal.Mul(-1)
+	}
+
+	diffuse = l.ambient
+	for i, light := range l.lights {
+		direction, radiance := light.Illuminate(point)
+		nDotL := normal.Dot(direction)
+		if nDotL <= 0 && !material.IsToon() {
+			continue
+		}
+		// Cel shaded faces also get the unlit end of the ramp on the side facing away from the light
+		nDotL = math.Max(nDotL, 0)
+		visibility := 1.0
+		if nDotL > 0 && material.ReceiveShadows && i < len(l.shadows) && l.shadows[i] != nil {
+			visibility = l.shadows[i].visibility(point, normal, direction)
+		}
+		if material.IsToon() {
+			toon := toonLight(material, nDotL*visibility)
+			diffuse = diffuse.Add(mgl.Vec3{radiance.X() * toon.X(), radiance.Y() * toon.Y(), radiance.Z() * toon.Z()}.Mul(material.Diffuse))
+		} else {
+			diffuse = diffuse.Add(radiance.Mul(nDotL * visibility * material.Diffuse))
+		}
+		radiance = radiance.Mul(visibility)
+		if material.Specular > 0 && nDotL > 0 {
+			halfway := direction.Add(toCamera)
+			if halfway.Len() == 0 {
+				continue
+			}
+			nDotH := math.Max(normal.Dot(halfway.Normalize()), 0)
+			highlight := math.Pow(nDotH, material.Shininess)
+			if material.IsToon() {
+				// Cel shaded highlights are spots with a hard edge where the highlight reaches half its strength
+				highlight = math.Round(highlight)
+			}
+			specular = specular.Add(radiance.Mul(material.Specular * highlight))
+		}
+	}
+	return diffuse, specular
+}
+
+// lightTriangle fills the lighting information of a projected triangle that was clipped from the face
+// depending on the shading mode of the face material
+func (l *lighting) lightTriangle(face FaceData, triangle ClippedTriangle, projected *object.ProjectedFaceData) {
+	material := projected.Material
+	projected.Lit = true
+	projected.Shading = material.Shading
+
+	normals := [3]mgl.Vec3{face.VertexNormal(0), face.VertexNormal(1), face.VertexNormal(2)}
+	if !face.HasNormals {
+		projected.Shading = ShadingFlat
+	}
+	if material.IsToon() || (material.ReceiveShadows && l.hasShadows()) {
+		// Bands and shadows are calculated per pixel so their edges don't follow the vertices. Flat faces keep their look with the face normal
+		if projected.Shading == ShadingFlat {
+			normal := face.Normal()
+			if normal.Dot(projected.Normals[0]) < 0 {
+				normal = normal.Mul(-1)
+			}
+			projected.Normals = [3]mgl.Vec3{normal, normal, normal}
+		}
+		projected.Shading = ShadingPhong
+	}
+
+	switch projected.Shading {
+	case ShadingFlat:
+		center := face.Face[0].Add(face.Face[1]).Add(face.Face[2]).Mul(1.0 / 3)
+		diffuse, specular := l.shade(center, face.Normal(), material)
+		projected.Diffuse = [3]mgl.Vec3{diffuse, diffuse, diffuse}
+		projected.Specular = [3]mgl.Vec3{specular, specular, specular}
+	case ShadingGouraud:
+		for i, weights := range triangle.Barycentric {
+			position := interpolateVec3(face.Face, weights)
+			normal := interpolateVec3(normals, weights)
+			projected.Diffuse[i], projected.Specular[i] = l.shade(position, normal, material)
+		}
+	case ShadingPhong:
+		// The positions and normals of the projected face are interpolated and lit per pixel
+	}
+}
+
+// interpolateVec3 interpolates three values with barycentric weights
+func interpolateVec3(values [3]mgl.Vec3, weights mgl.Vec3) mgl.Vec3 {
+	return values[0].Mul(weights[0]).Add(values[1].Mul(weights[1])).Add(values[2].Mul(weights[2]))
+}
+
+// applyLight multiplies the color with the diffuse light and adds the specular light
+func applyLight(rgba color.RGBA, diffuse, specular mgl.Vec3) color.RGBA {
+	alpha := float64(rgba.A)
+	return color.RGBA{
+		R: clampChannel(float64(rgba.R)*diffuse.X()+specular.X()*alpha, alpha),
+		G: clampChannel(float64(rgba.G)*diffuse.Y()+specular.Y()*alpha, alpha),
+		B: clampChannel(float64(rgba.B)*diffuse.Z()+specular.Z()*alpha, alpha),
+		A: rgba.A,
+	}
+}
+
+// clampChannel clamps a premultiplied color channel between 0 and the alpha value
+func clampChannel(value, alpha float64) uint8 {
+	if value < 0 {
+		return 0
+	}
+	if value > alpha {
+		return uint8(alpha)
+	}
+	return uint8(value)
+}
+
+// hasShadows returns whether at least one light of the frame has a shadow map
+func (l *lighting) hasShadows() bool {
+	for _, shadow := range l.shadows {
+		if shadow != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// toonLight quantizes the amount of light from one light (0 to 1) for cel shading.
+// Returns the factor for every color channel the light color is multiplied with
+func toonLight(material *Material, amount float64) mgl.Vec3 {
+	amount = math.Max(0, math.Min(1, amount))
+	if ramp := material.ToonRamp; ramp != nil {
+		bounds := ramp.Bounds()
+		if !bounds.Empty() {
+			x := bounds.Min.X + int(amount*float64(bounds.Dx()-1)+0.5)
+			return ColorToVec3(ramp.At(x, bounds.Min.Y+bounds.Dy()/2))
+		}
+	}
+	bands := material.ToonBands
+	if bands <= 1 {
+		return mgl.Vec3{1, 1, 1}
+	}
+	// The lowest band is unlit and the highest one fully lit
+	level := min(math.Floor(amount*float64(bands)), float64(bands-1)) / float64(bands-1)
+	return mgl.Vec3{level, level, level}
+}
@@ -0,0 +1,180 @@
+package renderer
+
+import (
+	. "github.com/virus-rpi/ThreeDView/types"
+	"image"
+	"image/color"
+	"math"
+)
+
+// zBufferPass replaces the colors with the logarithmic depth as grayscale, near pixels are bright
+type zBufferPass struct{}
+
+func (pass *zBufferPass) Apply(buffers *FrameBuffers) {
+	img, zBuffer := buffers.Color, buffers.Depth
+	minZ, maxZ, ok := depthRange(zBuffer, math.Log, 0.02, 0.98)
+	if !ok {
+		fillImage(img, color.White)
+		return
+	}
+	if minZ == maxZ {
+		minZ, maxZ = 0, 1
+	}
+	for y := 0; y < zBuffer.Height; y++ {
+		for x := 0; x < zBuffer.Width; x++ {
+			z := zBuffer.perspectiveDepth(zBuffer.Index(x, y))
+			var gray uint8 = 255
+			if !math.IsInf(z, 1) && z > 0 {
+				logZ := math.Log(z)
+				norm := (logZ - minZ) / (maxZ - minZ)
+				if norm < 0 {
+					norm = 0
+				}
+				if norm > 1 {
+					norm = 1
+				}
+				gray = uint8(norm * 255)
+			}
+			setPixel(img, x, y, color.RGBA{R: 255 - gray, G: 255 - gray, B: 255 - gray, A: 255})
+		}
+	}
+}
+
+// pseudoShadingPass darkens pixels depending on their depth
+type pseudoShadingPass struct{}
+
+func (pass *pseudoShadingPass) Apply(buffers *FrameBuffers) {
+	img, zBuffer := buffers.Color, buffers.Depth
+
+	const minShadeFactor = 0.7
+	const maxShadeFactor = 1.0
+
+	minZ, maxZ, ok := depthRange(zBuffer, func(z float64) float64 { return z }, 0.02, 0.98)
+	if !ok {
+		return
+	}
+	if minZ == maxZ {
+		minZ, maxZ = 0, 1
+	}
+
+	for y := 0; y < zBuffer.Height; y++ {
+		for x := 0; x < zBuffer.Width; x++ {
+			z := zBuffer.perspectiveDepth(zBuffer.Index(x, y))
+
+			if !math.IsInf(z, 1) && z > 0 {
+				norm := (z - minZ) / (maxZ - minZ)
+				if norm < 0 {
+					norm = 0
+				}
+				if norm > 1 {
+					norm = 1
+				}
+
+				shadeFactor := maxShadeFactor - (norm * (maxShadeFactor - minShadeFactor))
+
+				originalColor := pixelAt(img, x, y)
+				newColor := color.RGBA{
+					R: uint8(float64(originalColor.R) * shadeFactor),
+					G: uint8(float64(originalColor.G) * shadeFactor),
+					B: uint8(float64(originalColor.B) * shadeFactor),
+					A: originalColor.A,
+				}
+				setPixel(img, x, y, newColor)
+			}
+		}
+	}
+}
+
+// edgeOutlinePass draws outlines where the depth, the normal or the object changes, configured by the outline settings of the widget
+type edgeOutlinePass struct {
+	mask    []bool    // Reused memory for the edge detection
+	scratch []float64 // Reused memory for the edge detection
+}
+
+func (pass *edgeOutlinePass) RequiredBuffers(widget ThreeDWidgetInterface) BufferFlags {
+	// The ID buffer is always needed to find the outline color of the object at an edge
+	required := BufferIDs
+	if widget.GetOutlineSettings().NormalEdges {
+		required |= BufferNormals
+	}
+	return required
+}
+
+func (pass *edgeOutlinePass) Apply(buffers *FrameBuffers) {
+	settings := buffers.Widget.GetOutlineSettings()
+	img, zBuffer := buffers.Color, buffers.Depth
+	size := len(zBuffer.Values)
+	if cap(pass.mask) < size {
+		pass.mask = make([]bool, size)
+		pass.scratch = make([]float64, size)
+	}
+	pass.mask, pass.scratch = pass.mask[:size], pass.scratch[:size]
+	clear(pass.mask)
+
+	if settings.DepthEdges {
+		detectZBufferEdges(zBuffer, pass.mask, pass.scratch, settings.DepthThreshold, settings.DepthModulation, settings.GrazingAnglePower, settings.GrazingAngleHardness)
+	}
+	if settings.NormalEdges && buffers.Normals != nil {
+		detectNormalEdges(buffers.Normals, zBuffer, pass.mask, math.Cos(float64(settings.NormalThreshold.ToRadians())))
+	}
+	if settings.ObjectEdges && buffers.IDs != nil {
+		detectObjectEdges(buffers, pass.mask)
+	}
+
+	defaultColor := color.RGBA{A: 255}
+	if settings.Color != nil {
+		defaultColor = color.RGBAModel.Convert(settings.Color).(color.RGBA)
+	}
+	// outlineColor returns the outline color of the object visible in a pixel
+	outlineColor := func(i int) color.RGBA {
+		if buffers.IDs == nil {
+			return defaultColor
+		}
+		face := buffers.Face(buffers.IDs.Values[i])
+		if face == nil {
+			return defaultColor
+		}
+		if outlined, ok := face.Object.(OutlinedObject); ok && outlined.OutlineColor() != nil {
+			return color.RGBAModel.Convert(outlined.OutlineColor()).(color.RGBA)
+		}
+		return defaultColor
+	}
+
+	// Every pixel takes the color of the closest edge pixel within the thickness, so the front object wins where outlines overlap
+	thickness := max(settings.Thickness, 0)
+	width, height := zBuffer.Width, zBuffer.Height
+	parallelRows(height, func(minY, maxY int) {
+		for y := minY; y < maxY; y++ {
+			for x := 0; x < width; x++ {
+				closest := -1
+				for ny := max(y-thickness, 0); ny <= min(y+thickness, height-1); ny++ {
+					for nx := max(x-thickness, 0); nx <= min(x+thickness, width-1); nx++ {
+						i := ny*width + nx
+						if pass.mask[i] && (closest < 0 || zBuffer.Values[i] < zBuffer.Values[closest]) {
+							closest = i
+						}
+					}
+				}
+				if closest >= 0 {
+					setPixel(img, x, y, outlineColor(closest))
+				}
+			}
+		}
+	})
+}
+
+// fxaaPass smooths edges based on luminance contrast
+type fxaaPass struct {
+	source *image.RGBA // Reused memory for the unfiltered image
+	luma   []float64   // Reused memory for the luminance of every pixel
+}
+
+func (pass *fxaaPass) Apply(buffers *FrameBuffers) {
+	width, height := buffers.Color.Bounds().Dx(), buffers.Color.Bounds().Dy()
+	pass.source = resizeImage(pass.source, width, height)
+	if cap(pass.luma) < width*height {
+		pass.luma = make([]float64, width*height)
+	}
+	pass.luma = pass.luma[:width*height]
+	applyFXAA(buffers.Color, pass.source, pass.luma)
+}
@@ -0,0 +1,76 @@
+package renderer
+
+import (
+	mgl "github.com/go-gl/mathgl/mgl64"
+	. "github.com/virus-rpi/ThreeDView/object"
+	. "github.com/virus-rpi/ThreeDView/types"
+	"sync"
+)
+
+// picking keeps the ID buffer and the faces of the last finished frame, so pixels can be looked up
+// while the next frame is rendered
+type picking struct {
+	mutex        sync.RWMutex
+	ids          *IDBuffer           // The ID buffer of the last frame, nil if it was disabled
+	spare        *IDBuffer           // The ID buffer that is rendered into next
+	faces        []ProjectedFaceData // The faces of the last frame, the face with ID i is at index i-1
+	sampleFactor int                 // The factor the screen positions of the faces are scaled with
+}
+
+// spareBuffer returns the ID buffer that isn't read by picking
+func (p *picking) spareBuffer() *IDBuffer {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if p.spare == nil {
+		p.spare = &IDBuffer{}
+	}
+	return p.spare
+}
+
+// finishFrame makes the ID buffer and faces of a finished frame available for picking
+func (p *picking) finishFrame(ids *IDBuffer, faces []ProjectedFaceData, sampleFactor int) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if ids != nil {
+		p.spare = p.ids
+	}
+	p.ids, p.faces, p.sampleFactor = ids, faces, sampleFactor
+}
+
+// pickAt looks up the face visible at a pixel and interpolates the world position at the pixel center
+func (p *picking) pickAt(x, y int) (PickResult, bool) {
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+	if p.ids == nil {
+		return PickResult{}, false
+	}
+	id := p.ids.At(x, y)
+	if id <= 0 || int(id) > len(p.faces) {
+		return PickResult{}, false
+	}
+	face := &p.faces[id-1]
+
+	center := mgl.Vec2{float64(x) + 0.5, float64(y) + 0.5}.Mul(float64(p.sampleFactor))
+	weights := perspectiveWeights(screenWeights(face.Face, center), face.W)
+	return PickResult{
+		Object:    face.Object,
+		FaceIndex: face.FaceIndex,
+		Position:  interpolateVec3(face.Positions, weights),
+	}, true
+}
+
+// screenWeights returns the barycentric weights of a point in a triangle in screen space
+func screenWeights(triangle [3]mgl.Vec2, point mgl.Vec2) mgl.Vec3 {
+	edgeFunction := func(a, b, p mgl.Vec2) float64 {
+		return (b.X()-a.X())*(p.Y()-a.Y()) - (b.Y()-a.Y())*(p.X()-a.X())
+	}
+	area := edgeFunction(triangle[0], triangle[1], triangle[2])
+	if area == 0 {
+		return mgl.Vec3{1.0 / 3, 1.0 / 3, 1.0 / 3}
+	}
+	return mgl.Vec3{
+		edgeFunction(triangle[1], triangle[2], point) / area,
+		edgeFunction(triangle[2], triangle[0], point) / area,
+		edgeFunction(triangle[0], triangle[1], point) / area,
+	}
+}
@@ -0,0 +1,227 @@
+package renderer
+
+import (
+	mgl "github.com/go-gl/mathgl/mgl64"
+	. "github.com/virus-rpi/ThreeDView/object"
+	. "github.com/virus-rpi/ThreeDView/types"
+	"image"
+	"math"
+	"sync"
+)
+
+// Names of the built-in post process passes
+const (
+	PassAmbientOcclusion = "ambientOcclusion" // Darkens creases and contact areas
+	PassZBuffer          = "zBuffer"          // Replaces the colors with the depth as grayscale
+	PassEdgeOutlines     = "edgeOutlines"     // Draws outlines where the depth changes abruptly
+	PassPseudoShading    = "pseudoShading"    // Darkens pixels that are further away
+	PassFog              = "fog"              // Blends pixels towards the fog color depending on their distance and height
+	PassFXAA             = "fxaa"             // Smooths edges based on luminance contrast
+)
+
+// BufferFlags selects optional buffers of a frame
+type BufferFlags int
+
+const (
+	BufferIDs     BufferFlags = 1 << iota // The ID buffer
+	BufferNormals                         // The normal buffer
+)
+
+// FrameBuffers holds the buffers of a rendered frame. Post process passes read and modify them in place
+type FrameBuffers struct {
+	Color   *image.RGBA           // The rendered colors, premultiplied by alpha
+	Depth   *DepthBuffer          // The depth of every pixel of Color
+	IDs     *IDBuffer             // The ID of the face visible in every pixel of Color, nil if not needed this frame
+	Normals *NormalBuffer         // The normal of the surface visible in every pixel of Color, nil if not needed this frame
+	Widget  ThreeDWidgetInterface // The widget or scene the frame was rendered for
+	faces   []ProjectedFaceData   // The faces of the frame, the face with ID i is at index i-1
+
+	viewProjection        mgl.Mat4 // Maps world space to clip space
+	inverseViewProjection mgl.Mat4 // Maps normalized device coordinates back to world space
+}
+
+// Project returns the pixel position and depth buffer value of a point in world space.
+// Returns false if the point is behind the camera
+func (buffers *FrameBuffers) Project(position mgl.Vec3) (x, y, depth float64, ok bool) {
+	clip := buffers.viewProjection.Mul4x1(position.Vec4(1))
+	if clip.W() <= 0 {
+		return 0, 0, 0, false
+	}
+	ndc := clip.Vec3().Mul(1 / clip.W())
+	x = (ndc.X() + 1) * 0.5 * float64(buffers.Depth.Width)
+	y = (1 - (ndc.Y()+1)*0.5) * float64(buffers.Depth.Height)
+	return x, y, buffers.Depth.Range.Depth(ndc.Z(), clip.W()), true
+}
+
+// WorldPosition reconstructs the world space position of the surface visible in a pixel from the depth buffer.
+// Returns false if nothing was drawn at the pixel
+func (buffers *FrameBuffers) WorldPosition(x, y int) (mgl.Vec3, bool) {
+	depth := buffers.Depth.At(x, y)
+	if math.IsInf(depth, 0) {
+		return mgl.Vec3{}, false
+	}
+	ndcX := (float64(x)+0.5)/float64(buffers.Depth.Width)*2 - 1
+	ndcY := 1 - (float64(y)+0.5)/float64(buffers.Depth.Height)*2
+	position := buffers.inverseViewProjection.Mul4x1(mgl.Vec4{ndcX, ndcY, buffers.Depth.Range.NDC(depth), 1})
+	if position.W() == 0 {
+		return mgl.Vec3{}, false
+	}
+	return position.Vec3().Mul(1 / position.W()), true
+}
+
+// Face returns the face with an ID from the ID buffer or nil if there is none
+func (buffers *FrameBuffers) Face(id int32) *ProjectedFaceData {
+	if id <= 0 || int(id) > len(buffers.faces) {
+		return nil
+	}
+	return &buffers.faces[id-1]
+}
+
+// BufferRequester is implemented by post process passes that need optional buffers.
+// The buffers are only filled while at least one enabled pass (or picking) needs them
+type BufferRequester interface {
+	RequiredBuffers(widget ThreeDWidgetInterface) BufferFlags
+}
+
+// PostProcessPass is an effect that is applied to a frame after all faces are rasterized
+type PostProcessPass interface {
+	Apply(buffers *FrameBuffers)
+}
+
+// PostProcessFunc is a function that can be used as a post process pass
+type PostProcessFunc func(buffers *FrameBuffers)
+
+func (f PostProcessFunc) Apply(buffers *FrameBuffers) {
+	f(buffers)
+}
+
+type postProcessEntry struct {
+	name    string
+	pass    PostProcessPass
+	enabled bool
+}
+
+// PostProcessChain is an ordered list of named post process passes that can be enabled and disabled individually.
+// It is safe to modify the chain while a frame is rendered, the changes apply from the next frame on
+type PostProcessChain struct {
+	mutex   sync.Mutex
+	entries []postProcessEntry
+}
+
+// index returns the position of the pass with the name or -1. The mutex has to be held
+func (chain *PostProcessChain) index(name string) int {
+	for i, entry := range chain.entries {
+		if entry.name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// Add appends an enabled pass to the end of the chain. A pass with the same name is replaced
+func (chain *PostProcessChain) Add(name string, pass PostProcessPass) {
+	chain.Insert(-1, name, pass)
+}
+
+// Insert inserts an enabled pass at the position in the chain. A negative index or one past the end appends the pass.
+// A pass with the same name is removed first
+func (chain *PostProcessChain) Insert(index int, name string, pass PostProcessPass) {
+	chain.mutex.Lock()
+	defer chain.mutex.Unlock()
+	if i := chain.index(name); i >= 0 {
+		chain.entries = append(chain.entries[:i], chain.entries[i+1:]...)
+	}
+	if index < 0 || index > len(chain.entries) {
+		index = len(chain.entries)
+	}
+	chain.entries = append(chain.entries[:index], append([]postProcessEntry{{name: name, pass: pass, enabled: true}}, chain.entries[index:]...)...)
+}
+
+// Remove removes the pass with the name from the chain
+func (chain *PostProcessChain) Remove(name string) {
+	chain.mutex.Lock()
+	defer chain.mutex.Unlock()
+	if i := chain.index(name); i >= 0 {
+		chain.entries = append(chain.entries[:i], chain.entries[i+1:]...)
+	}
+}
+
+// Move moves the pass with the name to the position in the chain. A negative index moves it to the end
+func (chain *PostProcessChain) Move(name string, index int) {
+	chain.mutex.Lock()
+	i := chain.index(name)
+	if i < 0 {
+		chain.mutex.Unlock()
+		return
+	}
+	entry := chain.entries[i]
+	chain.mutex.Unlock()
+	chain.Insert(index, name, entry.pass)
+	chain.SetEnabled(name, entry.enabled)
+}
+
+// SetEnabled enables or disables the pass with the name. Disabled passes keep their position in the chain
+func (chain *PostProcessChain) SetEnabled(name string, enabled bool) {
+	chain.mutex.Lock()
+	defer chain.mutex.Unlock()
+	if i := chain.index(name); i >= 0 {
+		chain.entries[i].enabled = enabled
+	}
+}
+
+// Enabled returns whether the pass with the name is in the chain and enabled
+func (chain *PostProcessChain) Enabled(name string) bool {
+	chain.mutex.Lock()
+	defer chain.mutex.Unlock()
+	i := chain.index(name)
+	return i >= 0 && chain.entries[i].enabled
+}
+
+// Pass returns the pass with the name or nil if it isn't in the chain
+func (chain *PostProcessChain) Pass(name string) PostProcessPass {
+	chain.mutex.Lock()
+	defer chain.mutex.Unlock()
+	if i := chain.index(name); i >= 0 {
+		return chain.entries[i].pass
+	}
+	return nil
+}
+
+// Names returns the names of all passes in the order they are applied
+func (chain *PostProcessChain) Names() []string {
+	chain.mutex.Lock()
+	defer chain.mutex.Unlock()
+	names := make([]string, len(chain.entries))
+	for i, entry := range chain.entries {
+		names[i] = entry.name
+	}
+	return names
+}
+
+// requiredBuffers returns the optional buffers needed by the enabled passes
+func (chain *PostProcessChain) requiredBuffers(widget ThreeDWidgetInterface) BufferFlags {
+	chain.mutex.Lock()
+	defer chain.mutex.Unlock()
+	var required BufferFlags
+	for _, entry := range chain.entries {
+		if requester, ok := entry.pass.(BufferRequester); ok && entry.enabled {
+			required |= requester.RequiredBuffers(widget)
+		}
+	}
+	return required
+}
+
+// apply runs all enabled passes in order
+func (chain *PostProcessChain) apply(buffers *FrameBuffers) {
+	chain.mutex.Lock()
+	passes := make([]PostProcessPass, 0, len(chain.entries))
+	for _, entry := range chain.entries {
+		if entry.enabled {
+			passes = append(passes, entry.pass)
+		}
+	}
+	chain.mutex.Unlock()
+	for _, pass := range passes {
+		pass.Apply(buffers)
+	}
+}
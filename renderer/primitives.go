@@ -0,0 +1,249 @@
+package renderer
+
+import (
+	mgl "github.com/go-gl/mathgl/mgl64"
+	. "github.com/virus-rpi/ThreeDView/types"
+	"image"
+	"image/color"
+	"math"
+)
+
+// lineEnd is one end of a clipped line segment in the space of the target buffers
+type lineEnd struct {
+	point     mgl.Vec2
+	z, w      float64
+	color     color.RGBA
+	halfWidth float64 // Half the line width in pixels at this end
+	distance  float64 // Distance along the polyline for the dash pattern
+}
+
+// lineStyle is how the pixels of the segments of a primitive are depth tested and drawn
+type lineStyle struct {
+	dash              []float64       // Alternating lengths of dashes and gaps, empty for solid lines
+	dashInScreenSpace bool            // Whether the distance along the line is interpolated linearly on the screen or perspective correct in world space
+	depthBias         float64         // The fraction of its distance every pixel is moved along the view direction before the depth test
+	layer             int32           // The layer that decides against faces at the same depth
+	coverage          *coverageBuffer // The pixels the polyline already blended, nil for point sets whose dots are all blended
+}
+
+// coverageBuffer marks the pixels one polyline already blended, so where its translucent segments overlap at their joints
+// or where it crosses itself the pixels are only blended once
+type coverageBuffer struct {
+	stamps []uint32 // The stamp of the polyline that last blended each pixel
+	stamp  uint32   // The stamp of the current polyline
+}
+
+// next starts a new polyline, so no pixel counts as blended. The stamps are only cleared when the counter wraps around
+func (buffer *coverageBuffer) next(size int) {
+	if len(buffer.stamps) != size {
+		buffer.stamps = make([]uint32, size)
+		buffer.stamp = 0
+	}
+	buffer.stamp++
+	if buffer.stamp == 0 {
+		clear(buffer.stamps)
+		buffer.stamp = 1
+	}
+}
+
+// mark marks the pixel at an index as blended and returns false if the current polyline already blended it
+func (buffer *coverageBuffer) mark(i int) bool {
+	if buffer.stamps[i] == buffer.stamp {
+		return false
+	}
+	buffer.stamps[i] = buffer.stamp
+	return true
+}
+
+// renderPrimitives draws the lines and points of all primitive objects depth tested into the target.
+// They are drawn after the opaque faces and before the transparent faces, so transparent faces in front of them are
+// blended over them. They write depth, so post process passes like fog treat them like faces, but they can't be picked
+func (r *Renderer) renderPrimitives(target *FrameBuffers, factor int) {
+	cam := r.widget.GetCamera()
+	pixelScale := worldToPixelScale(cam.ViewProjection(), target.Depth.Width)
+	for _, obj := range r.widget.GetObjects() {
+		primitiveObject, ok := obj.(PrimitiveObject)
+		if !ok {
+			continue
+		}
+		for _, primitive := range primitiveObject.Primitives() {
+			halfWidth := func(w float64) float64 {
+				width := primitive.Width * float64(factor)
+				if primitive.WidthMode == WidthWorld {
+					width = primitive.Width * pixelScale / w
+				}
+				// Lines thinner than a pixel would have gaps
+				return math.Max(width/2, 0.5*float64(factor))
+			}
+			colorAt := func(i int) color.RGBA {
+				c := primitive.Color
+				if i < len(primitive.Colors) && primitive.Colors[i] != nil {
+					c = primitive.Colors[i]
+				}
+				if c == nil {
+					return color.RGBA{A: 255}
+				}
+				return color.RGBAModel.Convert(c).(color.RGBA)
+			}
+			style := lineStyle{depthBias: math.Max(primitive.DepthBias, -0.9), layer: int32(primitive.Layer)}
+
+			if primitive.Kind == PrimitivePoints {
+				for i, point := range primitive.Points {
+					line, ok := cam.ClipAndProjectLine(point, point)
+					if !ok {
+						continue
+					}
+					end := lineEnd{point: line.Points[0].Mul(float64(factor)), z: line.Z[0], w: line.W[0], color: colorAt(i), halfWidth: halfWidth(line.W[0])}
+					drawLineSegment(target, end, end, style)
+				}
+				continue
+			}
+
+			style.dash = primitive.Dash
+			style.dashInScreenSpace = primitive.WidthMode == WidthPixels
+			r.lineCoverage.next(len(target.Depth.Values))
+			style.coverage = &r.lineCoverage
+			worldDistance, screenDistance := 0.0, 0.0
+			for i := 0; i+1 < len(primitive.Points); i++ {
+				start, stop := primitive.Points[i], primitive.Points[i+1]
+				length := stop.Sub(start).Len()
+				line, ok := cam.ClipAndProjectLine(start, stop)
+				if !ok {
+					worldDistance += length
+					continue
+				}
+				var ends [2]lineEnd
+				for j := range ends {
+					ends[j] = lineEnd{
+						point:     line.Points[j].Mul(float64(factor)),
+						z:         line.Z[j],
+						w:         line.W[j],
+						color:     mixColors(colorAt(i), colorAt(i+1), line.T[j]),
+						halfWidth: halfWidth(line.W[j]),
+						distance:  worldDistance + line.T[j]*length,
+					}
+				}
+				if primitive.WidthMode == WidthPixels {
+					// Dashes in pixels are measured along the lines on the screen
+					ends[0].distance = screenDistance
+					screenDistance += ends[1].point.Sub(ends[0].point).Len() / float64(factor)
+					ends[1].distance = screenDistance
+				}
+				drawLineSegment(target, ends[0], ends[1], style)
+				worldDistance += length
+			}
+		}
+	}
+}
+
+// worldToPixelScale returns the pixels per world unit at a clip space W of 1 in an image of the given width.
+// Divided by the clip space W of a point it gives the pixels per world unit at the point.
+// The length of the first row of the view projection is the x scale of the projection, the view doesn't scale
+func worldToPixelScale(viewProjection mgl.Mat4, width int) float64 {
+	return mgl.Vec3{viewProjection.At(0, 0), viewProjection.At(0, 1), viewProjection.At(0, 2)}.Len() * float64(width) / 2
+}
+
+// drawLineSegment draws a line with round caps between two ends, a segment with two equal ends is a round dot.
+// Pixels are depth tested like the pixels of faces, with the depth bias and layer of the style.
+// If the dash pattern of the style isn't empty, only the dashes are drawn
+func drawLineSegment(target *FrameBuffers, start, end lineEnd, style lineStyle) {
+	coverLineSegment(target, start, end, func(x, y int, s float64) {
+		// Depth is linear on the screen, all other attributes are interpolated perspective correct
+		z := start.z + (end.z-start.z)*s
+		t := perspectiveT(start, end, s)
+		if target.Depth.Range.Mode == DepthLogarithmic {
+			z = target.Depth.Range.Depth(z, start.w+(end.w-start.w)*t)
+		}
+		if style.depthBias != 0 {
+			z = target.Depth.Range.Offset(z, style.depthBias)
+		}
+		i := target.Depth.Index(x, y)
+		if !target.Depth.depthTest(i, z, style.layer, coplanarTolerance) {
+			return
+		}
+		if len(style.dash) > 0 {
+			distance := start.distance + (end.distance-start.distance)*t
+			if style.dashInScreenSpace {
+				distance = start.distance + (end.distance-start.distance)*s
+			}
+			if !inDash(distance, style.dash) {
+				return
+			}
+		}
+		c := mixColors(start.color, end.color, t)
+		if c.A < 255 {
+			if style.coverage == nil || style.coverage.mark(i) {
+				blendPixel(target.Color, x, y, c)
+			}
+			return
+		}
+		target.Depth.Values[i] = z
+		target.Depth.setLayer(i, style.layer)
+		if target.IDs != nil {
+			target.IDs.Values[i] = 0
+		}
+		if target.Normals != nil {
+			target.Normals.Values[i] = mgl.Vec3{}
+		}
+		setPixel(target.Color, x, y, c)
+	})
+}
+
+// coverLineSegment calls cover for every pixel of the target whose center is closer to the segment between the ends
+// than half the width, with the position s of the closest point on the segment on the screen from 0 (start) to 1 (end)
+func coverLineSegment(target *FrameBuffers, start, end lineEnd, cover func(x, y int, s float64)) {
+	maxHalfWidth := math.Max(start.halfWidth, end.halfWidth)
+	bounds := image.Rect(
+		int(math.Floor(math.Min(start.point.X(), end.point.X())-maxHalfWidth)),
+		int(math.Floor(math.Min(start.point.Y(), end.point.Y())-maxHalfWidth)),
+		int(math.Ceil(math.Max(start.point.X(), end.point.X())+maxHalfWidth))+1,
+		int(math.Ceil(math.Max(start.point.Y(), end.point.Y())+maxHalfWidth))+1,
+	).Intersect(image.Rect(0, 0, target.Depth.Width, target.Depth.Height))
+
+	direction := end.point.Sub(start.point)
+	lengthSquared := direction.Dot(direction)
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			center := mgl.Vec2{float64(x) + 0.5, float64(y) + 0.5}
+			s := 0.0
+			if lengthSquared > 0 {
+				s = math.Max(0, math.Min(1, center.Sub(start.point).Dot(direction)/lengthSquared))
+			}
+			halfWidth := start.halfWidth + (end.halfWidth-start.halfWidth)*s
+			if center.Sub(start.point.Add(direction.Mul(s))).Len() > halfWidth {
+				continue
+			}
+			cover(x, y, s)
+		}
+	}
+}
+
+// perspectiveT converts the position s between two ends on the screen to the position along the segment in world space
+func perspectiveT(start, end lineEnd, s float64) float64 {
+	if start.w <= 0 || end.w <= 0 {
+		return s
+	}
+	return (s / end.w) / ((1-s)/start.w + s/end.w)
+}
+
+// inDash returns whether a distance along a line falls into a dash of the alternating dash and gap lengths
+func inDash(distance float64, dash []float64) bool {
+	total := 0.0
+	for _, length := range dash {
+		total += math.Max(length, 0)
+	}
+	if total <= 0 {
+		return true
+	}
+	distance = math.Mod(distance, total)
+	if distance < 0 {
+		distance += total
+	}
+	for i, length := range dash {
+		if distance < length {
+			return i%2 == 0
+		}
+		distance -= math.Max(length, 0)
+	}
+	return true
+}
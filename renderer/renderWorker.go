@@ -4,7 +4,9 @@ import (
 	mgl "github.com/go-gl/mathgl/mgl64"
 	"github.com/virus-rpi/ThreeDView/object"
 	"github.com/virus-rpi/ThreeDView/types"
+	"image/color"
 	"log"
+	"math"
 )
 
 type instruction struct {
@@ -12,6 +14,7 @@ type instruction struct {
 	data            interface{}
 	callbackChannel chan interface{}
 	doneFunction    func()
+	frame           *frame
 }
 
 type renderWorker struct {
@@ -43,28 +46,80 @@ func (rw *renderWorker) processInstruction(instruction *instruction) {
 	case "clipAndProject":
 		rw.clipAndProject(instruction)
 		break
+	case "rasterizeTile":
+		rw.rasterizeTile(instruction)
+		break
 	}
 	instruction.doneFunction()
 }
 
 func (rw *renderWorker) clipAndProject(instruction *instruction) {
 	face := instruction.data.(types.FaceData)
+	material := face.Material
+	if material == nil {
+		material = types.DefaultMaterial
+	}
+	if instruction.frame != nil && face.IsCulled(material.Cull, instruction.frame.cameraPosition) {
+		return
+	}
 
 	clippedPolys := rw.w.GetCamera().ClipAndProjectFace(face, face.TexCoords)
 	if clippedPolys == nil {
 		return
 	}
 
+	// Normals are turned towards the camera, so both sides of double-sided faces get the same normals
+	normals := [3]mgl.Vec3{face.VertexNormal(0), face.VertexNormal(1), face.VertexNormal(2)}
+	if instruction.frame != nil && face.Normal().Dot(instruction.frame.cameraPosition.Sub(face.Face[0])) < 0 {
+		for i := range normals {
+			normals[i] = normals[i].Mul(-1)
+		}
+	}
+
+	vertexColors := faceVertexColors(face)
+
+	width, height := rw.w.GetWidth(), rw.w.GetHeight()
+	if instruction.frame != nil && instruction.frame.sampleFactor > 1 {
+		width, height = width*types.Pixel(instruction.frame.sampleFactor), height*types.Pixel(instruction.frame.sampleFactor)
+	}
+
 	for _, triangle := range clippedPolys {
-		if !triangleOverlapsScreen(triangle.Points[0], triangle.Points[1], triangle.Points[2], rw.w.GetWidth(), rw.w.GetHeight()) {
+		// The slope of the bias is measured in pixels of the image, so it doesn't change with supersampling
+		depthBias := faceDepthBias(material, triangle)
+		if instruction.frame != nil && instruction.frame.sampleFactor > 1 {
+			// Screen positions are scaled to the sample grid, every pixel covers sampleFactor x sampleFactor samples
+			for i := range triangle.Points {
+				triangle.Points[i] = triangle.Points[i].Mul(float64(instruction.frame.sampleFactor))
+			}
+		}
+		if !triangleOverlapsScreen(triangle.Points[0], triangle.Points[1], triangle.Points[2], width, height) {
 			continue
 		}
 
 		projectedFace := object.ProjectedFaceData{
-			Face:     triangle.Points,
-			Z:        triangle.Z,
-			Color:    face.Color,
-			Distance: face.Distance,
+			Face:      triangle.Points,
+			Z:         triangle.Z,
+			W:         triangle.W,
+			Color:     face.AverageColor(),
+			Distance:  face.Distance,
+			Material:  material,
+			Object:    face.Object,
+			FaceIndex: face.Index,
+			DepthBias: depthBias,
+		}
+		for i, weights := range triangle.Barycentric {
+			projectedFace.Positions[i] = interpolateVec3(face.Face, weights)
+			projectedFace.Normals[i] = interpolateVec3(normals, weights)
+		}
+		if face.HasColors {
+			projectedFace.HasColors = true
+			for i, weights := range triangle.Barycentric {
+				projectedFace.Colors[i] = interpolateColor(vertexColors, weights)
+			}
+		}
+
+		if instruction.frame != nil && instruction.frame.lighting != nil {
+			instruction.frame.lighting.lightTriangle(face, triangle, &projectedFace)
 		}
 
 		if face.HasTexture && triangle.HasTexture {
@@ -77,6 +132,42 @@ func (rw *renderWorker) clipAndProject(instruction *instruction) {
 	}
 }
 
+// faceVertexColors returns the premultiplied colors of the vertices of a face, opaque black for vertices without a color
+func faceVertexColors(face types.FaceData) [3]color.RGBA {
+	var vertexColors [3]color.RGBA
+	for i := range vertexColors {
+		vertexColors[i] = color.RGBA{A: 255}
+		if c := face.VertexColor(i); c != nil {
+			vertexColors[i] = color.RGBAModel.Convert(c).(color.RGBA)
+		}
+	}
+	return vertexColors
+}
+
+func (rw *renderWorker) rasterizeTile(instruction *instruction) {
+	t := instruction.data.(*tile)
+	var light *lighting
+	if instruction.frame != nil {
+		light = instruction.frame.lighting
+	}
+	for _, face := range t.opaqueFaces {
+		drawFilledTriangle(t.target, face, face.HasTexture && t.useTextures, light, false, t.bounds)
+	}
+	for _, face := range t.transparentFaces {
+		drawFilledTriangle(t.target, face, face.HasTexture && t.useTextures, light, true, t.bounds)
+	}
+}
+
+// faceDepthBias returns the fraction of its distance a projected triangle is moved along the view direction
+func faceDepthBias(material *types.Material, triangle types.ClippedTriangle) float64 {
+	bias := material.DepthBias
+	if material.DepthSlopeBias != 0 {
+		bias += material.DepthSlopeBias * depthSlope(triangle.Points, triangle.W)
+	}
+	// Faces can't be moved to or behind the camera
+	return math.Max(bias, -0.9)
+}
+
 func triangleOverlapsScreen(p1, p2, p3 mgl.Vec2, width, height types.Pixel) bool {
 	minX := min(int(p1.X()), min(int(p2.X()), int(p3.X())))
 	maxX := max(int(p1.X()), max(int(p2.X()), int(p3.X())))
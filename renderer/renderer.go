@@ -1,13 +1,12 @@
 package renderer
 
 import (
+	mgl "github.com/go-gl/mathgl/mgl64"
 	. "github.com/virus-rpi/ThreeDView/object"
 	. "github.com/virus-rpi/ThreeDView/types"
 	"image"
 	"image/color"
-	"image/draw"
 	"log"
-	"math"
 	"runtime"
 	"sort"
 	"sync"
@@ -15,23 +14,56 @@ import (
 )
 
 type Renderer struct {
-	widget        ThreeDWidgetInterface
-	img           *image.RGBA
-	zBuffer       [][]float64
-	renderWorkers []*renderWorker
-	workerChannel chan *instruction
+	widget         ThreeDWidgetInterface
+	img            *image.RGBA    // The image the current frame is rendered into
+	images         [2]*image.RGBA // Two images used alternately, so the last frame stays intact while the next one is rendered
+	zBuffer        *DepthBuffer
+	normals        *NormalBuffer  // Reused memory for the normal buffer
+	samples        FrameBuffers   // Reused memory for the buffers faces are rasterized into when supersampling
+	shadowMaps     []*DepthBuffer // Reused memory for the shadow maps, one per light
+	casters        []FaceData     // Reused memory for the faces that are drawn into the shadow maps
+	lineCoverage   coverageBuffer // Reused memory for the pixels a polyline already blended
+	pickDepth      *DepthBuffer   // Reused memory for the depth of faces that are only rasterized into the ID buffer
+	postProcessing *PostProcessChain
+	picking        picking // The ID buffer and faces of the last finished frame
+	renderWorkers  []*renderWorker
+	workerChannel  chan *instruction
+	closeOnce      sync.Once // Terminates the workers only once, so Close can be called multiple times
+}
+
+// frame holds the state that is shared by all workers while rendering one frame
+type frame struct {
+	lighting       *lighting // nil if faces should not be lit
+	cameraPosition mgl.Vec3  // The camera position in world space, used for culling
+	sampleFactor   int       // The number of samples per pixel along each axis, projected faces are scaled by it
 }
 
 func NewRenderer(widget ThreeDWidgetInterface) *Renderer {
 	runtime.GOMAXPROCS(runtime.NumCPU())
 	renderer := &Renderer{
-		widget:        widget,
-		img:           nil,
-		zBuffer:       nil,
-		renderWorkers: make([]*renderWorker, runtime.NumCPU()),
-		workerChannel: make(chan *instruction, 1000),
+		widget:         widget,
+		img:            nil,
+		zBuffer:        &DepthBuffer{},
+		normals:        &NormalBuffer{},
+		pickDepth:      &DepthBuffer{},
+		samples:        FrameBuffers{Depth: &DepthBuffer{}, IDs: &IDBuffer{}, Normals: &NormalBuffer{}},
+		postProcessing: &PostProcessChain{},
+		renderWorkers:  make([]*renderWorker, runtime.NumCPU()),
+		workerChannel:  make(chan *instruction, 1000),
 	}
 
+	renderer.postProcessing.Add(PassAmbientOcclusion, &ambientOcclusionPass{})
+	renderer.postProcessing.Add(PassZBuffer, &zBufferPass{})
+	renderer.postProcessing.Add(PassEdgeOutlines, &edgeOutlinePass{})
+	renderer.postProcessing.Add(PassPseudoShading, &pseudoShadingPass{})
+	renderer.postProcessing.Add(PassFog, &fogPass{})
+	renderer.postProcessing.Add(PassFXAA, &fxaaPass{})
+	renderer.postProcessing.SetEnabled(PassAmbientOcclusion, false)
+	renderer.postProcessing.SetEnabled(PassZBuffer, false)
+	renderer.postProcessing.SetEnabled(PassEdgeOutlines, false)
+	renderer.postProcessing.SetEnabled(PassFog, false)
+	renderer.postProcessing.SetEnabled(PassFXAA, false)
+
 	for i := range renderer.renderWorkers {
 		renderer.renderWorkers[i] = newRenderWorker(renderer.widget, renderer.workerChannel)
 		go renderer.renderWorkers[i].start()
@@ -39,31 +71,94 @@ func NewRenderer(widget ThreeDWidgetInterface) *Renderer {
 	return renderer
 }
 
-func (r *Renderer) setupImg() {
-	r.img = image.NewRGBA(image.Rect(0, 0, int(r.widget.GetWidth()), int(r.widget.GetHeight())))
-	draw.Draw(r.img, r.img.Bounds(), &image.Uniform{C: r.widget.GetBackgroundColor()}, image.Point{}, draw.Src)
+// setupImg switches to the other image, resizes it if the size changed and clears it with the background color.
+// When faces are rendered into samples, every pixel is overwritten when they are resolved, so only the samples are cleared
+func (r *Renderer) setupImg(factor int) {
+	width, height := int(r.widget.GetWidth()), int(r.widget.GetHeight())
+	r.images[0], r.images[1] = r.images[1], resizeImage(r.images[0], width, height)
+	r.img = r.images[1]
+	if factor > 1 {
+		return
+	}
+	fillImage(r.img, r.widget.GetBackgroundColor())
+	if background := r.widget.GetBackground(); background != nil {
+		drawBackground(r.img, background, r.widget.GetCamera())
+	}
 }
 
-func (r *Renderer) resetZBuffer() {
-	width := int(r.widget.GetWidth())
-	height := int(r.widget.GetHeight())
-	r.zBuffer = make([][]float64, width)
-	for i := range r.zBuffer {
-		r.zBuffer[i] = make([]float64, height)
-		for j := range r.zBuffer[i] {
-			r.zBuffer[i][j] = math.Inf(1)
-		}
+// setupBuffers clears the depth buffer and the optional buffers that are needed this frame and returns all buffers of the frame.
+// The ID buffer is swapped with the one of the last frame, so picking can read that one while this frame is rendered
+func (r *Renderer) setupBuffers() *FrameBuffers {
+	width, height := r.img.Bounds().Dx(), r.img.Bounds().Dy()
+	r.zBuffer.resize(width, height)
+	r.zBuffer.clear()
+	r.zBuffer.Range = r.widget.GetCamera().DepthRange()
+	viewProjection := r.widget.GetCamera().ViewProjection()
+	buffers := &FrameBuffers{Color: r.img, Depth: r.zBuffer, Widget: r.widget, viewProjection: viewProjection, inverseViewProjection: viewProjection.Inv()}
+
+	required := r.postProcessing.requiredBuffers(r.widget)
+	if r.widget.GetRenderIDBuffer() {
+		required |= BufferIDs
+	}
+	if required&BufferIDs != 0 {
+		buffers.IDs = r.picking.spareBuffer()
+		buffers.IDs.resize(width, height)
+		buffers.IDs.clear()
 	}
+	if required&BufferNormals != 0 {
+		buffers.Normals = r.normals
+		buffers.Normals.resize(width, height)
+		buffers.Normals.clear()
+	}
+	return buffers
 }
 
-func (r *Renderer) clipAndProjectFaces() []ProjectedFaceData {
+// sampleFactor returns the number of samples per pixel along each axis of the current frame
+func (r *Renderer) sampleFactor() int {
+	if r.widget.GetAntiAliasing() != AntiAliasingSupersampling {
+		return 1
+	}
+	return max(r.widget.GetSupersamplingFactor(), 1)
+}
+
+// setupSamples returns the buffers faces are rasterized into, with the same optional buffers as the frame.
+// Without supersampling these are the buffers of the frame itself
+func (r *Renderer) setupSamples(buffers *FrameBuffers, factor int) *FrameBuffers {
+	if factor == 1 {
+		return buffers
+	}
+	width, height := buffers.Color.Bounds().Dx()*factor, buffers.Color.Bounds().Dy()*factor
+	r.samples.Color = resizeImage(r.samples.Color, width, height)
+	fillImage(r.samples.Color, r.widget.GetBackgroundColor())
+	if background := r.widget.GetBackground(); background != nil {
+		drawBackground(r.samples.Color, background, r.widget.GetCamera())
+	}
+	r.samples.Depth.resize(width, height)
+	r.samples.Depth.clear()
+	r.samples.Depth.useLayers(len(buffers.Depth.Layers) > 0)
+	r.samples.Depth.Range = buffers.Depth.Range
+	samples := &FrameBuffers{Color: r.samples.Color, Depth: r.samples.Depth, Widget: r.widget, faces: buffers.faces}
+	if buffers.IDs != nil {
+		samples.IDs = r.samples.IDs
+		samples.IDs.resize(width, height)
+		samples.IDs.clear()
+	}
+	if buffers.Normals != nil {
+		samples.Normals = r.samples.Normals
+		samples.Normals.resize(width, height)
+		samples.Normals.clear()
+	}
+	return samples
+}
+
+func (r *Renderer) clipAndProjectFaces(currentFrame *frame) []ProjectedFaceData {
 	callbackChannel := make(chan interface{}, 10000)
 	wg := &sync.WaitGroup{}
 	wg.Add(1)
 	go func() {
 		for faceData := range r.widget.GetCamera().GetVisibleFaces() {
 			wg.Add(1)
-			r.workerChannel <- &instruction{instructionType: "clipAndProject", data: faceData, callbackChannel: callbackChannel, doneFunction: func() {
+			r.workerChannel <- &instruction{instructionType: "clipAndProject", data: faceData, callbackChannel: callbackChannel, frame: currentFrame, doneFunction: func() {
 				wg.Done()
 			}}
 		}
@@ -81,197 +176,177 @@ func (r *Renderer) clipAndProjectFaces() []ProjectedFaceData {
 	return projectedFaces
 }
 
-func (r *Renderer) renderColors(faces []ProjectedFaceData) {
-	if r.widget.GetRenderFaceColors() {
-		for _, face := range faces {
-			drawFilledTriangle(r.img, face, r.zBuffer, face.HasTexture && r.widget.GetRenderTextures())
+// usesLayers returns whether any face or primitive is in a layer other than 0, so the depth buffers need to store the layers
+func (r *Renderer) usesLayers(faces []ProjectedFaceData) bool {
+	for _, face := range faces {
+		if face.Material != nil && face.Material.Layer != 0 {
+			return true
 		}
 	}
+	for _, obj := range r.widget.GetObjects() {
+		if primitiveObject, ok := obj.(PrimitiveObject); ok {
+			for _, primitive := range primitiveObject.Primitives() {
+				if primitive.Layer != 0 {
+					return true
+				}
+			}
+		}
+	}
+	return false
 }
 
-func (r *Renderer) renderFaceOutlines(faces []ProjectedFaceData) {
-	if r.widget.GetRenderFaceOutlines() {
-		for _, face := range faces {
-			var outlineColor color.Color
-			if !r.widget.GetRenderFaceColors() {
-				outlineColor = face.Color
-			} else {
-				outlineColor = color.Black
-			}
-			drawEdge(r.img, face.Face[0], face.Z[0], face.Face[1], face.Z[1], outlineColor, r.zBuffer)
-			drawEdge(r.img, face.Face[1], face.Z[1], face.Face[2], face.Z[2], outlineColor, r.zBuffer)
-			drawEdge(r.img, face.Face[2], face.Z[2], face.Face[0], face.Z[0], outlineColor, r.zBuffer)
+// splitFaces separates the opaque faces from the transparent ones, which are sorted back to front.
+// Opaque faces get their position in the faces of the frame as ID, so picking can look them up again.
+// Transparent faces don't write to the ID buffer, so they can't be picked and the faces behind them are picked instead
+func splitFaces(faces []ProjectedFaceData) (opaqueFaces, transparentFaces []ProjectedFaceData) {
+	for i := range faces {
+		if faces[i].Material.IsTransparent(faces[i].Color) {
+			transparentFaces = append(transparentFaces, faces[i])
+		} else {
+			faces[i].ID = int32(i + 1)
+			opaqueFaces = append(opaqueFaces, faces[i])
 		}
 	}
+	sort.Slice(transparentFaces, func(i, j int) bool {
+		return transparentFaces[i].Distance > transparentFaces[j].Distance
+	})
+	return opaqueFaces, transparentFaces
 }
 
-func (r *Renderer) renderZBuffer() {
-	if !r.widget.GetRenderZBuffer() {
+// renderColors rasterizes the opaque faces, or blends the transparent faces over what was drawn before without writing depth
+func (r *Renderer) renderColors(target *FrameBuffers, faces []ProjectedFaceData, transparent bool, currentFrame *frame) {
+	if !r.widget.GetRenderFaceColors() || len(faces) == 0 {
 		return
 	}
-	img := image.NewRGBA(r.img.Bounds())
-	var logZVals []float64
-	for x := 0; x < r.img.Bounds().Dx(); x++ {
-		for y := 0; y < r.img.Bounds().Dy(); y++ {
-			if len(r.zBuffer) <= x || len(r.zBuffer[x]) <= y {
-				continue
-			}
-			z := r.zBuffer[x][y]
-			if !math.IsInf(z, 1) && !math.IsInf(z, -1) && z > 0 {
-				logZVals = append(logZVals, math.Log(z))
-			}
-		}
-	}
-	if len(logZVals) == 0 {
-		r.img = img
+	opaqueFaces, transparentFaces := faces, []ProjectedFaceData(nil)
+	if transparent {
+		opaqueFaces, transparentFaces = nil, faces
 	}
-	sort.Float64s(logZVals)
-	lowIdx := int(0.02 * float64(len(logZVals)))
-	highIdx := int(0.98 * float64(len(logZVals)))
-	if highIdx <= lowIdx {
-		lowIdx = 0
-		highIdx = len(logZVals) - 1
+	wg := &sync.WaitGroup{}
+	for _, t := range binFaces(target, opaqueFaces, transparentFaces, r.widget.GetRenderTextures()) {
+		if len(t.opaqueFaces) == 0 && len(t.transparentFaces) == 0 {
+			continue
+		}
+		wg.Add(1)
+		r.workerChannel <- &instruction{instructionType: "rasterizeTile", data: t, frame: currentFrame, doneFunction: func() {
+			wg.Done()
+		}}
 	}
-	if len(logZVals) == 0 {
-		r.img = img
+	wg.Wait()
+}
+
+// renderWithoutColors rasterizes the opaque faces without drawing colors if face colors are disabled.
+// With the wireframe enabled they fill the depth buffer, so they hide the edges behind them. Otherwise they keep the depth
+// buffer empty like before and only fill the ID buffer with their own depth, so they can still be picked.
+// Returns the depth buffer the IDs were written with, which is the depth of the target unless only IDs were rasterized
+func (r *Renderer) renderWithoutColors(target *FrameBuffers, faces []ProjectedFaceData) *DepthBuffer {
+	if r.widget.GetRenderFaceColors() {
+		return target.Depth
 	}
-	minZ, maxZ := logZVals[lowIdx], logZVals[highIdx]
-	if minZ == maxZ {
-		minZ, maxZ = 0, 1
+	if r.widget.GetWireframe().Enabled {
+		r.renderDepth(&FrameBuffers{Depth: target.Depth, IDs: target.IDs, Normals: target.Normals}, faces)
+		return target.Depth
 	}
-	for x := 0; x < r.img.Bounds().Dx(); x++ {
-		for y := 0; y < r.img.Bounds().Dy(); y++ {
-			if len(r.zBuffer) <= x || len(r.zBuffer[x]) <= y {
-				log.Println("Skipping pixel due to out of bounds zBuffer access at", x, y)
-				continue
-			}
-			z := r.zBuffer[x][y]
-			var gray uint8 = 255
-			if !math.IsInf(z, 1) && z > 0 {
-				logZ := math.Log(z)
-				norm := (logZ - minZ) / (maxZ - minZ)
-				if norm < 0 {
-					norm = 0
-				}
-				if norm > 1 {
-					norm = 1
-				}
-				gray = uint8(norm * 255)
-			}
-			img.Set(x, y, color.Gray{Y: 255 - gray})
-		}
+	if target.IDs == nil {
+		return target.Depth
 	}
-	r.img = img
+	r.pickDepth.resize(target.Depth.Width, target.Depth.Height)
+	r.pickDepth.clear()
+	r.pickDepth.useLayers(len(target.Depth.Layers) > 0)
+	r.pickDepth.Range = target.Depth.Range
+	r.renderDepth(&FrameBuffers{Depth: r.pickDepth, IDs: target.IDs}, faces)
+	return r.pickDepth
 }
 
-func (r *Renderer) renderPseudoShading() {
-	if !r.widget.GetRenderPseudoShading() {
-		return
+// renderDepth rasterizes the opaque faces into the depth buffer and the optional ID and normal buffer of a target without a color buffer
+func (r *Renderer) renderDepth(target *FrameBuffers, faces []ProjectedFaceData) {
+	wg := &sync.WaitGroup{}
+	// Textures are only sampled for the alpha test of cutouts
+	for _, t := range binFaces(target, faces, nil, r.widget.GetRenderTextures()) {
+		if len(t.opaqueFaces) == 0 {
+			continue
+		}
+		wg.Add(1)
+		r.workerChannel <- &instruction{instructionType: "rasterizeTile", data: t, doneFunction: func() {
+			wg.Done()
+		}}
 	}
+	wg.Wait()
+}
 
-	const minShadeFactor = 0.7
-	const maxShadeFactor = 1.0
-
-	var zVals []float64
-	for x := 0; x < r.img.Bounds().Dx(); x++ {
-		for y := 0; y < r.img.Bounds().Dy(); y++ {
-			if len(r.zBuffer) <= x || len(r.zBuffer[x]) <= y {
-				continue
-			}
-			z := r.zBuffer[x][y]
-			if !math.IsInf(z, 1) && !math.IsInf(z, -1) && z > 0 {
-				zVals = append(zVals, z)
+func (r *Renderer) renderFaceOutlines(target *FrameBuffers, faces []ProjectedFaceData) {
+	if r.widget.GetRenderFaceOutlines() {
+		for _, face := range faces {
+			var outlineColor color.Color
+			if !r.widget.GetRenderFaceColors() {
+				outlineColor = face.Color
+			} else {
+				outlineColor = color.Black
 			}
+			drawEdge(target.Color, face.Face[0], face.Z[0], face.Face[1], face.Z[1], outlineColor, target.Depth)
+			drawEdge(target.Color, face.Face[1], face.Z[1], face.Face[2], face.Z[2], outlineColor, target.Depth)
+			drawEdge(target.Color, face.Face[2], face.Z[2], face.Face[0], face.Z[0], outlineColor, target.Depth)
 		}
 	}
-	if len(zVals) == 0 {
-		return
-	}
-	sort.Float64s(zVals)
-	lowIdx := int(0.02 * float64(len(zVals)))
-	highIdx := int(0.98 * float64(len(zVals)))
-	if highIdx <= lowIdx {
-		lowIdx = 0
-		highIdx = len(zVals) - 1
-	}
-	if len(zVals) == 0 {
-		return
-	}
-	minZ, maxZ := zVals[lowIdx], zVals[highIdx]
-	if minZ == maxZ {
-		minZ, maxZ = 0, 1
-	}
-
-	for x := 0; x < r.img.Bounds().Dx(); x++ {
-		for y := 0; y < r.img.Bounds().Dy(); y++ {
-			if len(r.zBuffer) <= x || len(r.zBuffer[x]) <= y {
-				log.Println("Skipping pixel due to out of bounds zBuffer access at", x, y)
-				continue
-			}
-			z := r.zBuffer[x][y]
-
-			if !math.IsInf(z, 1) && z > 0 {
-				norm := (z - minZ) / (maxZ - minZ)
-				if norm < 0 {
-					norm = 0
-				}
-				if norm > 1 {
-					norm = 1
-				}
+}
 
-				shadeFactor := maxShadeFactor - (norm * (maxShadeFactor - minShadeFactor))
+// PostProcessing returns the chain of post process passes that are applied to every frame.
+// It contains the built-in passes PassAmbientOcclusion, PassZBuffer, PassEdgeOutlines, PassPseudoShading, PassFog and PassFXAA in that order
+func (r *Renderer) PostProcessing() *PostProcessChain {
+	return r.postProcessing
+}
 
-				originalColor := r.img.At(x, y).(color.RGBA)
-				newColor := color.RGBA{
-					R: uint8(float64(originalColor.R) * shadeFactor),
-					G: uint8(float64(originalColor.G) * shadeFactor),
-					B: uint8(float64(originalColor.B) * shadeFactor),
-					A: originalColor.A,
-				}
-				r.img.Set(x, y, newColor)
-			}
-		}
-	}
+// PickAt returns what is visible at a pixel of the last rendered frame.
+// Returns false if nothing pickable is at the pixel or the ID buffer is disabled. Transparent faces can't be picked
+func (r *Renderer) PickAt(x, y int) (PickResult, bool) {
+	return r.picking.pickAt(x, y)
 }
 
-func (r *Renderer) renderEdgeOutlines() {
-	if !r.widget.GetRenderEdgeOutlines() {
-		return
-	}
-	edgeMask := detectZBufferEdges(r.zBuffer, 0.05, 0.1, 5.0, 0.5)
-	thickness := 1
-	outlineColor := color.Black
-	for x := 0; x < r.img.Bounds().Dx(); x++ {
-		for y := 0; y < r.img.Bounds().Dy(); y++ {
-			if edgeMask[x][y] {
-				for dx := -thickness; dx <= thickness; dx++ {
-					for dy := -thickness; dy <= thickness; dy++ {
-						nx, ny := x+dx, y+dy
-						if nx >= 0 && nx < r.img.Bounds().Dx() && ny >= 0 && ny < r.img.Bounds().Dy() {
-							r.img.Set(nx, ny, outlineColor)
-						}
-					}
-				}
-			}
+// Close terminates all render workers. The renderer can't be used afterwards. Calling it again has no effect
+func (r *Renderer) Close() {
+	r.closeOnce.Do(func() {
+		for range r.renderWorkers {
+			r.workerChannel <- &instruction{instructionType: "terminate", doneFunction: func() {}}
 		}
-	}
+	})
 }
 
-func (r *Renderer) Render() image.Image {
-	r.setupImg()
+// Render renders a frame and returns the image. The renderer alternates between two images,
+// so the returned image is overwritten two frames later. Copy it if it has to be kept longer
+func (r *Renderer) Render() *image.RGBA {
 	if len(r.widget.GetObjects()) == 0 {
+		r.setupImg(1)
+		r.picking.finishFrame(nil, nil, 1)
 		return r.img
 	}
-	r.resetZBuffer()
+	factor := r.sampleFactor()
+	r.setupImg(factor)
+	buffers := r.setupBuffers()
 	startTime1 := time.Now()
-	faces := r.clipAndProjectFaces()
+	currentFrame := &frame{lighting: newLighting(r.widget), cameraPosition: r.widget.GetCamera().Position(), sampleFactor: factor}
+	if currentFrame.lighting != nil {
+		r.renderShadowMaps(currentFrame.lighting)
+	}
+	faces := r.clipAndProjectFaces(currentFrame)
 	log.Println("Projection and clipping took", time.Since(startTime1))
 	startTime2 := time.Now()
-	r.renderColors(faces)
-	r.renderFaceOutlines(faces)
-	r.renderZBuffer()
-	r.renderEdgeOutlines()
-	r.renderPseudoShading()
+	buffers.faces = faces
+	buffers.Depth.useLayers(r.usesLayers(faces))
+	samples := r.setupSamples(buffers, factor)
+	opaqueFaces, transparentFaces := splitFaces(faces)
+	r.renderColors(samples, opaqueFaces, false, currentFrame)
+	idDepth := r.renderWithoutColors(samples, opaqueFaces)
+	// Primitives are drawn before the transparent faces, which don't write depth and would otherwise be drawn over
+	r.renderPrimitives(samples, factor)
+	r.renderColors(samples, transparentFaces, true, currentFrame)
+	r.renderWireframe(samples, factor)
+	r.renderFaceOutlines(samples, faces)
+	if factor > 1 {
+		resolveSamples(samples, buffers, idDepth, factor)
+	}
+	r.postProcessing.apply(buffers)
+	r.renderBillboards(buffers)
+	r.picking.finishFrame(buffers.IDs, faces, factor)
 	log.Println("Rendering took", time.Since(startTime2))
 	log.Println("FPS:", int(1.0/time.Since(startTime1).Seconds()))
 	return r.img
@@ -0,0 +1,184 @@
+package renderer
+
+import (
+	mgl "github.com/go-gl/mathgl/mgl64"
+	"github.com/virus-rpi/ThreeDView/camera"
+	. "github.com/virus-rpi/ThreeDView/object"
+	. "github.com/virus-rpi/ThreeDView/types"
+	"math"
+	"sync"
+)
+
+// shadowMap is the depth of the scene seen from a light, rendered every frame for every light that casts shadows
+type shadowMap struct {
+	depth          *DepthBuffer
+	viewProjection mgl.Mat4       // Maps world space to the clip space of the shadow map
+	settings       ShadowSettings // The shadow settings of the light
+	texelScale     float64        // Multiplied with the clip space W of a point this gives the world size of a texel at the point
+}
+
+// visibility returns how much of the light reaches a point, from 0 (in shadow) to 1 (lit).
+// toLight is the normalized direction from the point towards the light
+func (shadow *shadowMap) visibility(point, normal, toLight mgl.Vec3) float64 {
+	clip := shadow.viewProjection.Mul4x1(point.Vec4(1))
+	if clip.W() <= 0 {
+		return 1
+	}
+	// The bias is measured in texels, so it scales with the area the map covers. Surfaces the light grazes
+	// get more bias because their depth changes faster across a texel and across the filter radius
+	cosAngle := math.Max(normal.Dot(toLight), 0.1)
+	slope := math.Sqrt(1-cosAngle*cosAngle) / cosAngle
+	settings := shadow.settings
+	bias := clip.W() * shadow.texelScale * (settings.Bias + settings.SlopeBias*slope*float64(1+max(settings.PCFRadius, 0)))
+	clip = shadow.viewProjection.Mul4x1(point.Add(toLight.Mul(bias)).Vec4(1))
+	if clip.W() <= 0 {
+		return 1
+	}
+	ndc := clip.Vec3().Mul(1 / clip.W())
+	if ndc.Z() > 1 {
+		return 1
+	}
+
+	// Every texel in the filter radius is compared and weighted by how much it overlaps a texel sized area around the point,
+	// so the shadow edges are smooth even without softening
+	size := float64(shadow.depth.Width)
+	x := (ndc.X()+1)*0.5*size - 0.5
+	y := (1-(ndc.Y()+1)*0.5)*size - 0.5
+	x0, y0 := math.Floor(x), math.Floor(y)
+	fractionX, fractionY := x-x0, y-y0
+	radius := max(settings.PCFRadius, 0)
+	edgeWeight := func(offset int, fraction float64) float64 {
+		switch offset {
+		case -radius:
+			return 1 - fraction
+		case radius + 1:
+			return fraction
+		}
+		return 1
+	}
+	lit, total := 0.0, 0.0
+	for offsetY := -radius; offsetY <= radius+1; offsetY++ {
+		weightY := edgeWeight(offsetY, fractionY)
+		for offsetX := -radius; offsetX <= radius+1; offsetX++ {
+			weight := weightY * edgeWeight(offsetX, fractionX)
+			total += weight
+			tx, ty := int(x0)+offsetX, int(y0)+offsetY
+			if tx < 0 || ty < 0 || tx >= shadow.depth.Width || ty >= shadow.depth.Height || ndc.Z() <= shadow.depth.At(tx, ty) {
+				lit += weight
+			}
+		}
+	}
+	if total == 0 {
+		return 1
+	}
+	return lit / total
+}
+
+// renderShadowMaps renders the shadow maps of all lights that cast shadows into the lighting of the frame
+func (r *Renderer) renderShadowMaps(l *lighting) {
+	l.shadows = make([]*shadowMap, len(l.lights))
+	var casters []FaceData
+	var bounds *AABB
+	loaded := false
+	for i, light := range l.lights {
+		shadowLight, ok := light.(ShadowLight)
+		if !ok || !shadowLight.ShadowSettings().Enabled || shadowLight.ShadowSettings().MapSize <= 0 {
+			continue
+		}
+		if !loaded {
+			casters, bounds = r.shadowCasters()
+			loaded = true
+		}
+		if len(casters) == 0 {
+			return
+		}
+		viewProjection, ok := shadowLight.ShadowViewProjection(*bounds)
+		if !ok {
+			continue
+		}
+
+		settings := shadowLight.ShadowSettings()
+		size := int(settings.MapSize)
+		for len(r.shadowMaps) <= i {
+			r.shadowMaps = append(r.shadowMaps, &DepthBuffer{})
+		}
+		depth := r.shadowMaps[i]
+		depth.resize(size, size)
+		depth.clear()
+		r.renderShadowMap(camera.NewShadowCamera(viewProjection, settings.MapSize), depth, casters)
+
+		// The length of the first row is the x scale of the projection, the view doesn't scale
+		xScale := mgl.Vec3{viewProjection.At(0, 0), viewProjection.At(0, 1), viewProjection.At(0, 2)}.Len()
+		l.shadows[i] = &shadowMap{depth: depth, viewProjection: viewProjection, settings: settings, texelScale: 2 / (xScale * float64(size))}
+	}
+}
+
+// shadowCasters returns the faces of all objects that cast shadows and the bounds of all faces, which the shadow maps have to cover.
+// The faces are collected from the octree of the camera, so they are only transformed again when objects change.
+// The materials are checked every frame, because changing them doesn't rebuild the octree. Transparent faces don't cast shadows
+func (r *Renderer) shadowCasters() ([]FaceData, *AABB) {
+	r.casters = r.casters[:0]
+	bounds := r.widget.GetCamera().ForEachSceneFace(func(face FaceData) {
+		material := face.Material
+		if material == nil {
+			material = DefaultMaterial
+		}
+		if material.CastShadows && !material.IsTransparent(face.AverageColor()) {
+			r.casters = append(r.casters, face)
+		}
+	})
+	return r.casters, bounds
+}
+
+// renderShadowMap clips and projects the faces with the camera of a light and rasterizes their depth into the shadow map
+func (r *Renderer) renderShadowMap(shadowCamera *camera.ShadowCamera, depth *DepthBuffer, casters []FaceData) {
+	var mutex sync.Mutex
+	var faces []ProjectedFaceData
+	parallelRows(len(casters), func(first, last int) {
+		var projected []ProjectedFaceData
+		for _, face := range casters[first:last] {
+			material := face.Material
+			if material == nil {
+				material = DefaultMaterial
+			}
+			if material.AlphaCutoff <= 0 {
+				for _, triangle := range shadowCamera.ClipAndProjectFace(face) {
+					projected = append(projected, ProjectedFaceData{Face: triangle.Points, Z: triangle.Z, W: triangle.W})
+				}
+				continue
+			}
+			// Cutouts need their color and texture for the alpha test, so only their opaque parts cast shadows
+			vertexColors := faceVertexColors(face)
+			for _, triangle := range shadowCamera.ClipAndProjectFace(face, face.TexCoords) {
+				projectedFace := ProjectedFaceData{Face: triangle.Points, Z: triangle.Z, W: triangle.W, Color: face.AverageColor(), Material: material}
+				if face.HasColors {
+					projectedFace.HasColors = true
+					for i, weights := range triangle.Barycentric {
+						projectedFace.Colors[i] = interpolateColor(vertexColors, weights)
+					}
+				}
+				if face.HasTexture && triangle.HasTexture {
+					projectedFace.TextureImage = face.TextureImage
+					projectedFace.TexCoords = triangle.TexCoords
+					projectedFace.HasTexture = true
+				}
+				projected = append(projected, projectedFace)
+			}
+		}
+		mutex.Lock()
+		faces = append(faces, projected...)
+		mutex.Unlock()
+	})
+
+	wg := &sync.WaitGroup{}
+	for _, t := range binFaces(&FrameBuffers{Depth: depth}, faces, nil, r.widget.GetRenderTextures()) {
+		if len(t.opaqueFaces) == 0 {
+			continue
+		}
+		wg.Add(1)
+		r.workerChannel <- &instruction{instructionType: "rasterizeTile", data: t, doneFunction: func() {
+			wg.Done()
+		}}
+	}
+	wg.Wait()
+}
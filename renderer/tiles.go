@@ -0,0 +1,63 @@
+package renderer
+
+import (
+	. "github.com/virus-rpi/ThreeDView/object"
+	"image"
+	"math"
+)
+
+// tileSize is the width and height of a tile in pixels
+const tileSize = 64
+
+// tile is a rectangular region of the screen. Tiles never overlap, so every tile owns its region of the
+// color and depth buffer and all tiles can be rasterized concurrently
+type tile struct {
+	bounds           image.Rectangle
+	opaqueFaces      []*ProjectedFaceData
+	transparentFaces []*ProjectedFaceData // Sorted back to front
+	target           *FrameBuffers
+	useTextures      bool
+}
+
+// binFaces splits the screen into tiles and adds every face to all tiles its bounding box overlaps.
+// The order of the faces is kept within every tile
+func binFaces(target *FrameBuffers, opaqueFaces, transparentFaces []ProjectedFaceData, useTextures bool) []*tile {
+	bounds := image.Rect(0, 0, target.Depth.Width, target.Depth.Height)
+	columns := (bounds.Dx() + tileSize - 1) / tileSize
+	rows := (bounds.Dy() + tileSize - 1) / tileSize
+	tiles := make([]*tile, columns*rows)
+	for row := 0; row < rows; row++ {
+		for column := 0; column < columns; column++ {
+			tileBounds := image.Rect(column*tileSize, row*tileSize, (column+1)*tileSize, (row+1)*tileSize).Intersect(bounds)
+			tiles[row*columns+column] = &tile{bounds: tileBounds, target: target, useTextures: useTextures}
+		}
+	}
+
+	bin := func(face *ProjectedFaceData, transparent bool) {
+		minX, minY := math.Inf(1), math.Inf(1)
+		maxX, maxY := math.Inf(-1), math.Inf(-1)
+		for _, p := range face.Face {
+			minX, minY = math.Min(minX, p.X()), math.Min(minY, p.Y())
+			maxX, maxY = math.Max(maxX, p.X()), math.Max(maxY, p.Y())
+		}
+		firstColumn, lastColumn := max(int(minX)/tileSize, 0), min(int(math.Ceil(maxX))/tileSize, columns-1)
+		firstRow, lastRow := max(int(minY)/tileSize, 0), min(int(math.Ceil(maxY))/tileSize, rows-1)
+		for row := firstRow; row <= lastRow; row++ {
+			for column := firstColumn; column <= lastColumn; column++ {
+				t := tiles[row*columns+column]
+				if transparent {
+					t.transparentFaces = append(t.transparentFaces, face)
+				} else {
+					t.opaqueFaces = append(t.opaqueFaces, face)
+				}
+			}
+		}
+	}
+	for i := range opaqueFaces {
+		bin(&opaqueFaces[i], false)
+	}
+	for i := range transparentFaces {
+		bin(&transparentFaces[i], true)
+	}
+	return tiles
+}
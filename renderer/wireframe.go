@@ -0,0 +1,121 @@
+package renderer
+
+import (
+	. "github.com/virus-rpi/ThreeDView/types"
+	"image/color"
+	"math"
+)
+
+// flatEdgeAngle is the angle in radians below which two faces count as one flat polygon, so the edge between them is hidden
+const flatEdgeAngle = 0.002
+
+// wireframeEdge is an edge that is drawn, clipped and projected to the target
+type wireframeEdge struct {
+	start, end   lineEnd
+	visibleColor color.RGBA
+	hiddenColor  color.RGBA
+}
+
+// renderWireframe draws the silhouettes, creases and open edges of all meshes. Edges hidden behind faces are left out,
+// or drawn dashed if the settings show hidden edges
+func (r *Renderer) renderWireframe(target *FrameBuffers, factor int) {
+	settings := r.widget.GetWireframe()
+	if !settings.Enabled {
+		return
+	}
+	cam := r.widget.GetCamera()
+	cameraPosition := cam.Position()
+	creaseCos := math.Cos(math.Max(float64(settings.CreaseAngle.ToRadians()), flatEdgeAngle))
+	halfWidth := math.Max(settings.Width/2, 0.5) * float64(factor)
+
+	var edges []wireframeEdge
+	for _, obj := range r.widget.GetObjects() {
+		edgeObject, ok := obj.(EdgeObject)
+		if !ok {
+			continue
+		}
+		for _, edge := range edgeObject.Edges() {
+			// Open edges and edges of more than two faces are always drawn
+			if len(edge.FaceNormals) == 2 {
+				first, second := edge.FaceNormals[0], edge.FaceNormals[1]
+				toCamera := cameraPosition.Sub(edge.Points[0])
+				silhouette := first.Dot(toCamera) > 0 != (second.Dot(toCamera) > 0)
+				if !silhouette && first.Dot(second) >= creaseCos {
+					continue
+				}
+			}
+			line, ok := cam.ClipAndProjectLine(edge.Points[0], edge.Points[1])
+			if !ok {
+				continue
+			}
+			visibleColor := settings.Color
+			if visibleColor == nil {
+				visibleColor = color.Black
+				if !r.widget.GetRenderFaceColors() && edge.Color != nil {
+					visibleColor = edge.Color
+				}
+			}
+			hiddenColor := settings.HiddenColor
+			if hiddenColor == nil {
+				hiddenColor = visibleColor
+			}
+			wireframe := wireframeEdge{
+				visibleColor: color.RGBAModel.Convert(visibleColor).(color.RGBA),
+				hiddenColor:  color.RGBAModel.Convert(hiddenColor).(color.RGBA),
+			}
+			wireframe.start = lineEnd{point: line.Points[0].Mul(float64(factor)), z: line.Z[0], w: line.W[0], halfWidth: halfWidth}
+			wireframe.end = lineEnd{point: line.Points[1].Mul(float64(factor)), z: line.Z[1], w: line.W[1], halfWidth: halfWidth}
+			// The dashes of hidden edges are measured in pixels from the start of every edge
+			wireframe.end.distance = wireframe.end.point.Sub(wireframe.start.point).Len() / float64(factor)
+			edges = append(edges, wireframe)
+		}
+	}
+
+	// Hidden edges are drawn first, so visible edges are always on top of them
+	for _, hiddenPass := range []bool{true, false} {
+		if hiddenPass && !settings.ShowHidden {
+			continue
+		}
+		for _, edge := range edges {
+			drawWireframeEdge(target, edge, hiddenPass, settings.HiddenDash)
+		}
+	}
+}
+
+// surfaceSlope returns how much the view depth of the surface in a pixel changes from one pixel to the next. Of the two
+// neighbors along each axis the closer depth is used, so the slope doesn't jump where another surface starts
+func surfaceSlope(depth *DepthBuffer, x, y int) float64 {
+	center := depth.ViewDepth(x, y)
+	axisSlope := func(dx, dy int) float64 {
+		slope := math.Min(math.Abs(depth.ViewDepth(x-dx, y-dy)-center), math.Abs(depth.ViewDepth(x+dx, y+dy)-center))
+		if math.IsInf(slope, 1) || math.IsNaN(slope) {
+			return 0
+		}
+		return slope
+	}
+	return math.Max(axisSlope(1, 0), axisSlope(0, 1))
+}
+
+// drawWireframeEdge draws the visible or the hidden pixels of an edge. A pixel of the edge is hidden if the surface in
+// the depth buffer is closer to the camera than the edge by more than that surface changes its depth over the width of
+// the edge. The faces of the edge itself are within that distance, even if the camera looks at them at a grazing angle,
+// while a flat face in front of the edge hides it
+func drawWireframeEdge(target *FrameBuffers, edge wireframeEdge, hiddenPass bool, dash []float64) {
+	coverLineSegment(target, edge.start, edge.end, func(x, y int, s float64) {
+		t := perspectiveT(edge.start, edge.end, s)
+		w := edge.start.w + (edge.end.w-edge.start.w)*t
+		tolerance := (edge.start.halfWidth+1)*surfaceSlope(target.Depth, x, y) + 1e-4*w
+		hidden := target.Depth.ViewDepth(x, y) < w-tolerance
+		if hidden != hiddenPass {
+			return
+		}
+		if !hidden {
+			blendPixel(target.Color, x, y, edge.visibleColor)
+			return
+		}
+		if len(dash) > 0 && !inDash(edge.end.distance*s, dash) {
+			return
+		}
+		blendPixel(target.Color, x, y, edge.hiddenColor)
+	})
+}
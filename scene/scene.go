@@ -0,0 +1,336 @@
+package scene
+
+import (
+	mgl "github.com/go-gl/mathgl/mgl64"
+	. "github.com/virus-rpi/ThreeDView/camera"
+	"github.com/virus-rpi/ThreeDView/renderer"
+	. "github.com/virus-rpi/ThreeDView/types"
+	"image"
+	"image/color"
+)
+
+// Scene holds objects, a camera and render settings and renders them into an image of an explicit size.
+// It does not depend on a Fyne app, so it can be used on a server, in a batch job or in tests
+type Scene struct {
+	width              Pixel                    // The width of the rendered image
+	height             Pixel                    // The height of the rendered image
+	camera             CameraInterface          // The camera of the scene
+	objects            []ObjectInterface        // The objects in the scene
+	tickMethods        []func()                 // The methods that are called every tick
+	bgColor            color.Color              // The background color of the scene
+	background         BackgroundInterface      // The background drawn instead of the background color, nil for the plain color
+	renderFaceOutlines bool                     // Whether the faces should be rendered with outlines
+	renderFaceColors   bool                     // Whether the faces should be rendered with colors
+	renderTextures     bool                     // Whether to use textures for rendering (if available)
+	renderLighting     bool                     // If true, shade faces with the lights of the scene
+	renderIDBuffer     bool                     // If true, record which face is visible in every pixel for picking
+	lights             []LightInterface         // The lights in the scene
+	ambientColor       color.Color              // The color of the ambient light
+	ambientIntensity   float64                  // The intensity of the ambient light
+	outlineSettings    OutlineSettings          // How edge outlines are detected and drawn
+	fog                FogSettings              // The distance and height fog
+	ambientOcclusion   AmbientOcclusionSettings // How the screen space ambient occlusion is calculated
+	wireframe          WireframeSettings        // How the edges of meshes are drawn with hidden line removal
+	antiAliasing       AntiAliasingMode         // How jagged edges are smoothed
+	supersampling      int                      // The number of samples per pixel along each axis when supersampling
+	renderer           *renderer.Renderer
+}
+
+// NewScene creates a new scene that renders images of the given size. A default camera at the origin is created
+func NewScene(width, height Pixel) *Scene {
+	s := &Scene{
+		width:            width,
+		height:           height,
+		bgColor:          color.Transparent,
+		renderFaceColors: true,
+		renderTextures:   true,
+		renderLighting:   true,
+		ambientColor:     color.White,
+		ambientIntensity: 0.2,
+		supersampling:    2,
+		outlineSettings:  NewOutlineSettings(),
+		fog:              NewFogSettings(),
+		ambientOcclusion: NewAmbientOcclusionSettings(),
+		wireframe:        NewWireframeSettings(),
+		objects:          make([]ObjectInterface, 0),
+	}
+	s.renderer = renderer.NewRenderer(s)
+	NewCamera(mgl.Vec3{}, mgl.QuatIdent(), s)
+	return s
+}
+
+// Render updates the camera and renders the scene into an image of the scene size
+func (s *Scene) Render() *image.RGBA {
+	s.camera.BuildOctree()
+	s.camera.UpdateCamera()
+	return s.renderer.Render()
+}
+
+// Tick calls all registered tick methods once and rebuilds the octree if objects changed
+func (s *Scene) Tick() {
+	for _, tick := range s.tickMethods {
+		tick()
+	}
+	s.camera.BuildOctree()
+}
+
+// Close stops the render workers of the scene. The scene can't be rendered afterwards
+func (s *Scene) Close() {
+	s.renderer.Close()
+}
+
+// RegisterTickMethod registers an animation function to be called every tick
+func (s *Scene) RegisterTickMethod(tick func()) {
+	s.tickMethods = append(s.tickMethods, tick)
+}
+
+// AddObject adds a 3D object as Object to the scene. This should be called in the method that creates the object
+func (s *Scene) AddObject(object ObjectInterface) {
+	s.objects = append(s.objects, object)
+	s.camera.RebuildOctree()
+}
+
+// AddLight adds a light to the scene. This should be called in the method that creates the light
+func (s *Scene) AddLight(light LightInterface) {
+	s.lights = append(s.lights, light)
+}
+
+// RemoveLight removes a light from the scene
+func (s *Scene) RemoveLight(light LightInterface) {
+	for i, l := range s.lights {
+		if l == light {
+			s.lights = append(s.lights[:i], s.lights[i+1:]...)
+			return
+		}
+	}
+}
+
+func (s *Scene) GetLights() []LightInterface { return s.lights }
+
+func (s *Scene) GetAmbientLight() (color.Color, float64) { return s.ambientColor, s.ambientIntensity }
+
+func (s *Scene) GetCamera() CameraInterface {
+	return s.camera
+}
+
+func (s *Scene) GetWidth() Pixel {
+	return s.width
+}
+
+func (s *Scene) GetHeight() Pixel {
+	return s.height
+}
+
+func (s *Scene) GetBackgroundColor() color.Color { return s.bgColor }
+
+func (s *Scene) GetBackground() BackgroundInterface { return s.background }
+
+func (s *Scene) GetObjects() []ObjectInterface { return s.objects }
+
+func (s *Scene) GetRenderFaceColors() bool {
+	return s.renderFaceColors
+}
+
+func (s *Scene) GetRenderTextures() bool {
+	return s.renderTextures
+}
+
+func (s *Scene) GetRenderFaceOutlines() bool {
+	return s.renderFaceOutlines
+}
+
+// GetRenderEdgeOutlines returns whether the edge outline pass is enabled in the post processing chain
+func (s *Scene) GetRenderEdgeOutlines() bool {
+	return s.renderer.PostProcessing().Enabled(renderer.PassEdgeOutlines)
+}
+
+// GetRenderZBuffer returns whether the depth debug pass is enabled in the post processing chain
+func (s *Scene) GetRenderZBuffer() bool {
+	return s.renderer.PostProcessing().Enabled(renderer.PassZBuffer)
+}
+
+// GetRenderPseudoShading returns whether the pseudo shading pass is enabled in the post processing chain
+func (s *Scene) GetRenderPseudoShading() bool {
+	return s.renderer.PostProcessing().Enabled(renderer.PassPseudoShading)
+}
+
+func (s *Scene) GetRenderLighting() bool {
+	return s.renderLighting
+}
+
+func (s *Scene) GetRenderIDBuffer() bool {
+	return s.renderIDBuffer
+}
+
+func (s *Scene) GetOutlineSettings() OutlineSettings {
+	return s.outlineSettings
+}
+
+func (s *Scene) GetFog() FogSettings {
+	return s.fog
+}
+
+func (s *Scene) GetAmbientOcclusionSettings() AmbientOcclusionSettings {
+	return s.ambientOcclusion
+}
+
+func (s *Scene) GetWireframe() WireframeSettings {
+	return s.wireframe
+}
+
+func (s *Scene) GetAntiAliasing() AntiAliasingMode {
+	return s.antiAliasing
+}
+
+func (s *Scene) GetSupersamplingFactor() int {
+	return s.supersampling
+}
+
+// PostProcessing returns the ordered chain of post process passes that are applied to every rendered frame.
+// Custom passes can be added, and all passes can be reordered, enabled or disabled by name
+func (s *Scene) PostProcessing() *renderer.PostProcessChain {
+	return s.renderer.PostProcessing()
+}
+
+// SetSize sets the size of the rendered image in pixels
+func (s *Scene) SetSize(width, height Pixel) {
+	s.width = width
+	s.height = height
+}
+
+// SetCamera sets the camera of the scene
+func (s *Scene) SetCamera(camera CameraInterface) {
+	s.camera = camera
+}
+
+// SetBackgroundColor sets the background color of the scene
+func (s *Scene) SetBackgroundColor(color color.Color) {
+	s.bgColor = color
+}
+
+// SetBackground sets a background like a gradient or a skybox that is drawn instead of the background color.
+// nil draws the plain background color
+func (s *Scene) SetBackground(background BackgroundInterface) {
+	s.background = background
+}
+
+// SetRenderFaceOutlines sets whether the faces should be rendered with outlines.
+// If false, only colors will be rendered. If colors are also false, nothing will be rendered.
+// If true, the faces will be rendered with black outlines or the color of the face if face colors are disabled.
+// Default is false
+func (s *Scene) SetRenderFaceOutlines(newVal bool) {
+	s.renderFaceOutlines = newVal
+}
+
+// SetRenderFaceColors sets whether the faces should be rendered with colors.
+// If false, only outlines will be rendered. If outline is also false, nothing will be rendered.
+// Default is true
+func (s *Scene) SetRenderFaceColors(newVal bool) {
+	s.renderFaceColors = newVal
+}
+
+// SetRenderTextures sets whether textures should be used for rendering (if available).
+// If true, faces with texture information will be rendered using their texture.
+// If false, all faces will be rendered using their solid color.
+// Default is true
+func (s *Scene) SetRenderTextures(newVal bool) {
+	s.renderTextures = newVal
+}
+
+// SetRenderEdgeOutline sets whether to render edge outlines using Z-buffer edge detection.
+// If true, edges will be detected using the Z-buffer and rendered with a black outline.
+// This enables or disables the renderer.PassEdgeOutlines pass of the post process chain.
+func (s *Scene) SetRenderEdgeOutline(newVal bool) {
+	s.renderer.PostProcessing().SetEnabled(renderer.PassEdgeOutlines, newVal)
+}
+
+// SetOutlineSettings sets how edge outlines are detected and drawn. Outlines are enabled with SetRenderEdgeOutline.
+// Default is NewOutlineSettings, which detects depth edges and draws black outlines
+func (s *Scene) SetOutlineSettings(settings OutlineSettings) {
+	s.outlineSettings = settings
+}
+
+// SetFog sets the distance and height fog. Fog is rendered by the renderer.PassFog post process pass,
+// which is enabled if the fog mode isn't FogNone or height fog is enabled.
+// Default is NewFogSettings, which has no fog
+func (s *Scene) SetFog(settings FogSettings) {
+	s.fog = settings
+	s.renderer.PostProcessing().SetEnabled(renderer.PassFog, settings.Mode != FogNone || settings.HeightFog)
+}
+
+// SetRenderAmbientOcclusion sets whether creases and contact areas are darkened with screen space ambient occlusion.
+// This enables or disables the renderer.PassAmbientOcclusion pass of the post process chain.
+// Default is false
+func (s *Scene) SetRenderAmbientOcclusion(newVal bool) {
+	s.renderer.PostProcessing().SetEnabled(renderer.PassAmbientOcclusion, newVal)
+}
+
+// SetAmbientOcclusionSettings sets how the screen space ambient occlusion is calculated.
+// Default is NewAmbientOcclusionSettings
+func (s *Scene) SetAmbientOcclusionSettings(settings AmbientOcclusionSettings) {
+	s.ambientOcclusion = settings
+}
+
+// SetWireframe sets how the edges of meshes are drawn. The wireframe draws every edge once and removes the hidden ones,
+// unlike SetRenderFaceOutlines which draws all three edges of every face. Without face colors the faces are still
+// rendered into the depth buffer, so they hide the edges behind them.
+// Default is NewWireframeSettings, which has the wireframe disabled
+func (s *Scene) SetWireframe(settings WireframeSettings) {
+	s.wireframe = settings
+}
+
+// SetRenderZBufferDebug sets whether to render the Z-buffer as a grayscale debug overlay.
+// This enables or disables the renderer.PassZBuffer pass of the post process chain.
+func (s *Scene) SetRenderZBufferDebug(newVal bool) {
+	s.renderer.PostProcessing().SetEnabled(renderer.PassZBuffer, newVal)
+}
+
+// SetRenderPseudoShading sets whether pixels are darkened depending on their depth.
+// This enables or disables the renderer.PassPseudoShading pass of the post process chain.
+// Default is true
+func (s *Scene) SetRenderPseudoShading(newVal bool) {
+	s.renderer.PostProcessing().SetEnabled(renderer.PassPseudoShading, newVal)
+}
+
+// SetRenderLighting sets whether faces should be shaded with the lights of the scene.
+// Lighting only has an effect if at least one light was added.
+// Default is true
+func (s *Scene) SetRenderLighting(newVal bool) {
+	s.renderLighting = newVal
+}
+
+// SetAmbientLight sets the color and intensity of the ambient light that is added to every lit face.
+// Default is white with an intensity of 0.2
+func (s *Scene) SetAmbientLight(color color.Color, intensity float64) {
+	s.ambientColor = color
+	s.ambientIntensity = intensity
+}
+
+// SetAntiAliasing sets how jagged edges are smoothed.
+// AntiAliasingFXAA enables the renderer.PassFXAA post process pass, AntiAliasingSupersampling renders every pixel from multiple samples.
+// Default is AntiAliasingNone
+func (s *Scene) SetAntiAliasing(mode AntiAliasingMode) {
+	s.antiAliasing = mode
+	s.renderer.PostProcessing().SetEnabled(renderer.PassFXAA, mode == AntiAliasingFXAA)
+}
+
+// SetSupersamplingFactor sets the number of samples per pixel along each axis used by AntiAliasingSupersampling.
+// A factor of 2 renders 4 samples per pixel, so the cost grows with the square of the factor.
+// Default is 2
+func (s *Scene) SetSupersamplingFactor(factor int) {
+	s.supersampling = max(factor, 1)
+}
+
+// SetRenderIDBuffer sets whether the face visible in every pixel is recorded in an ID buffer, which is needed for PickAt.
+// Faces are recorded even if face colors are disabled. Transparent faces are not recorded, the faces behind them are.
+// Default is false
+func (s *Scene) SetRenderIDBuffer(newVal bool) {
+	s.renderIDBuffer = newVal
+}
+
+// PickAt returns the object, face index and world position of the opaque face visible at a pixel of the last rendered image.
+// Returns false if nothing is at the pixel or the ID buffer is disabled (see SetRenderIDBuffer).
+// Transparent faces are not pickable
+func (s *Scene) PickAt(x, y Pixel) (PickResult, bool) {
+	return s.renderer.PickAt(int(x), int(y))
+}
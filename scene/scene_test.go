@@ -0,0 +1,683 @@
+package scene
+
+import (
+	mgl "github.com/go-gl/mathgl/mgl64"
+	"github.com/virus-rpi/ThreeDView/background"
+	"github.com/virus-rpi/ThreeDView/light"
+	"github.com/virus-rpi/ThreeDView/object"
+	"github.com/virus-rpi/ThreeDView/renderer"
+	"github.com/virus-rpi/ThreeDView/texture"
+	. "github.com/virus-rpi/ThreeDView/types"
+	"image"
+	"image/color"
+	"math"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+const (
+	testWidth  = 64
+	testHeight = 48
+)
+
+var (
+	white = color.RGBA{R: 255, G: 255, B: 255, A: 255}
+	red   = color.RGBA{R: 255, A: 255}
+)
+
+// newTestScene creates a scene with a white background and an unlit red cube of size 2 at the origin,
+// seen by the camera from 5 units in front of it, so its front face at z = 1 covers the center of the image
+func newTestScene(t *testing.T) (*Scene, *object.Object) {
+	t.Helper()
+	s := NewScene(testWidth, testHeight)
+	t.Cleanup(s.Close)
+	s.SetBackgroundColor(white)
+	s.SetRenderLighting(false)
+	s.SetRenderPseudoShading(false)
+	eye := mgl.Vec3{0, 0, 5}
+	s.GetCamera().SetPosition(eye)
+	s.GetCamera().SetRotation(mgl.QuatLookAtV(eye, mgl.Vec3{}, mgl.Vec3{0, 1, 0}).Inverse())
+	cube := object.NewCube(2, mgl.Vec3{}, mgl.QuatIdent(), red, s)
+	return s, cube
+}
+
+// captureDepth adds a post process pass that copies the view depth of every pixel of each frame
+func captureDepth(s *Scene) func(x, y int) float64 {
+	var depth []float64
+	s.PostProcessing().Add("capture depth", renderer.PostProcessFunc(func(buffers *renderer.FrameBuffers) {
+		depth = make([]float64, buffers.Depth.Width*buffers.Depth.Height)
+		for y := 0; y < buffers.Depth.Height; y++ {
+			for x := 0; x < buffers.Depth.Width; x++ {
+				depth[buffers.Depth.Index(x, y)] = buffers.Depth.ViewDepth(x, y)
+			}
+		}
+	}))
+	return func(x, y int) float64 {
+		return depth[y*testWidth+x]
+	}
+}
+
+func TestRenderPixels(t *testing.T) {
+	for _, mode := range []AntiAliasingMode{AntiAliasingNone, AntiAliasingSupersampling} {
+		s, _ := newTestScene(t)
+		s.SetAntiAliasing(mode)
+		img := s.Render()
+		if img.Bounds().Dx() != testWidth || img.Bounds().Dy() != testHeight {
+			t.Fatalf("anti aliasing %v: image size = %v, want %dx%d", mode, img.Bounds().Size(), testWidth, testHeight)
+		}
+		if got := img.RGBAAt(testWidth/2, testHeight/2); got != red {
+			t.Errorf("anti aliasing %v: center pixel = %v, want %v", mode, got, red)
+		}
+		if got := img.RGBAAt(0, 0); got != white {
+			t.Errorf("anti aliasing %v: corner pixel = %v, want %v", mode, got, white)
+		}
+	}
+}
+
+func TestRenderEmptyScene(t *testing.T) {
+	s := NewScene(testWidth, testHeight)
+	defer s.Close()
+	s.SetBackgroundColor(white)
+	img := s.Render()
+	for _, point := range [][2]int{{0, 0}, {testWidth / 2, testHeight / 2}, {testWidth - 1, testHeight - 1}} {
+		if got := img.RGBAAt(point[0], point[1]); got != white {
+			t.Errorf("pixel %v = %v, want %v", point, got, white)
+		}
+	}
+}
+
+func TestRenderDepth(t *testing.T) {
+	for _, mode := range []DepthMode{DepthStandard, DepthReversed, DepthLogarithmic} {
+		s, _ := newTestScene(t)
+		s.GetCamera().SetDepthMode(mode)
+		depthAt := captureDepth(s)
+		s.Render()
+		if got := depthAt(testWidth/2, testHeight/2); math.Abs(got-4) > 1e-3 {
+			t.Errorf("mode %v: center view depth = %v, want 4", mode, got)
+		}
+		if got := depthAt(0, 0); !math.IsInf(got, 1) {
+			t.Errorf("mode %v: corner view depth = %v, want +Inf", mode, got)
+		}
+	}
+}
+
+func TestPickAt(t *testing.T) {
+	for _, mode := range []AntiAliasingMode{AntiAliasingNone, AntiAliasingSupersampling} {
+		for _, faceColors := range []bool{true, false} {
+			s, cube := newTestScene(t)
+			s.SetAntiAliasing(mode)
+			s.SetRenderIDBuffer(true)
+			s.SetRenderFaceColors(faceColors)
+			s.Render()
+			result, ok := s.PickAt(testWidth/2, testHeight/2)
+			if !ok {
+				t.Errorf("anti aliasing %v, face colors %v: nothing picked at the center", mode, faceColors)
+				continue
+			}
+			if result.Object != cube {
+				t.Errorf("anti aliasing %v, face colors %v: picked %v, want the cube", mode, faceColors, result.Object)
+			}
+			if math.Abs(result.Position.Z()-1) > 1e-3 || math.Abs(result.Position.X()) > 0.1 || math.Abs(result.Position.Y()) > 0.1 {
+				t.Errorf("anti aliasing %v, face colors %v: picked position = %v, want about (0, 0, 1)", mode, faceColors, result.Position)
+			}
+			if _, ok := s.PickAt(0, 0); ok {
+				t.Errorf("anti aliasing %v, face colors %v: picked something at the corner", mode, faceColors)
+			}
+		}
+	}
+}
+
+func TestRenderWhileTicking(t *testing.T) {
+	s, _ := newTestScene(t)
+	// Every tick rebuilds the octree while frames query it
+	s.RegisterTickMethod(s.GetCamera().RebuildOctree)
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 20; i++ {
+			s.Tick()
+		}
+	}()
+	for i := 0; i < 20; i++ {
+		if got := s.Render().RGBAAt(testWidth/2, testHeight/2); got != red {
+			t.Errorf("frame %d: center pixel = %v, want %v", i, got, red)
+		}
+	}
+	wg.Wait()
+}
+
+func TestCloseTwice(t *testing.T) {
+	s := NewScene(testWidth, testHeight)
+	s.Render()
+	s.Close()
+	s.Close()
+}
+
+// TestTransparentSharedEdge renders two semi-transparent triangles that share an edge. Every pixel covered by the
+// opaque triangles has to be blended exactly once, so there are no gaps or darker pixels along the shared edge
+func TestTransparentSharedEdge(t *testing.T) {
+	// The corners are off the pixel grid and the quad is tilted, so the shared diagonal crosses pixels at arbitrary positions
+	corners := [4]mgl.Vec3{{-1.37, -0.91, 0.3}, {1.13, -1.07, -0.2}, {1.29, 0.97, -0.4}, {-1.21, 1.03, 0.1}}
+	tilted := func(mgl.Mat4) [2][3]mgl.Vec3 {
+		return [2][3]mgl.Vec3{{corners[0], corners[1], corners[2]}, {corners[0], corners[2], corners[3]}}
+	}
+	// The shared edge is vertical through the centers of the pixels right of the image center, so every pixel along it
+	// is exactly on the edge of both triangles
+	throughCenters := func(viewProjection mgl.Mat4) [2][3]mgl.Vec3 {
+		x := 5 / (testWidth * viewProjection.At(0, 0))
+		return [2][3]mgl.Vec3{{{-1, -1, 0}, {x, -1, 0}, {x, 1, 0}}, {{x, -1, 0}, {1.2, 0.3, 0}, {x, 1, 0}}}
+	}
+
+	for _, mode := range []DepthMode{DepthStandard, DepthReversed, DepthLogarithmic} {
+		for _, quad := range []struct {
+			name  string
+			faces func(viewProjection mgl.Mat4) [2][3]mgl.Vec3
+			angle float64
+		}{
+			{"tilted", tilted, 0},
+			{"tilted rotated", tilted, 0.3},
+			{"tilted rotated further", tilted, 2.5},
+			{"through pixel centers", throughCenters, 0},
+		} {
+			covered, coveredCount := renderTriangles(t, mode, quad.faces, quad.angle, 1)
+			blended, blendedCount := renderTriangles(t, mode, quad.faces, quad.angle, 0.5)
+			if coveredCount == 0 {
+				t.Fatalf("mode %v, %s: the triangles cover no pixels", mode, quad.name)
+			}
+			if blendedCount != coveredCount {
+				t.Errorf("mode %v, %s: %d pixels blended, want the %d covered pixels", mode, quad.name, blendedCount, coveredCount)
+			}
+			var want color.RGBA
+			for i := range covered {
+				if covered[i] == white {
+					continue
+				}
+				if want == (color.RGBA{}) {
+					want = blended[i]
+				}
+				if blended[i] != want {
+					t.Errorf("mode %v, %s: pixel %d = %v, want %v", mode, quad.name, i, blended[i], want)
+					break
+				}
+			}
+		}
+	}
+}
+
+// renderTriangles renders two red triangles of the given opacity rotated around the view direction and returns the
+// pixels and the number of pixels that aren't the white background. The triangles are created from the view projection
+func renderTriangles(t *testing.T, mode DepthMode, faces func(viewProjection mgl.Mat4) [2][3]mgl.Vec3, angle, opacity float64) ([]color.RGBA, int) {
+	t.Helper()
+	s := NewScene(testWidth, testHeight)
+	defer s.Close()
+	s.SetBackgroundColor(white)
+	s.SetRenderLighting(false)
+	s.SetRenderPseudoShading(false)
+	s.GetCamera().SetDepthMode(mode)
+	eye := mgl.Vec3{0, 0, 5}
+	s.GetCamera().SetPosition(eye)
+	s.GetCamera().SetRotation(mgl.QuatLookAtV(eye, mgl.Vec3{}, mgl.Vec3{0, 1, 0}).Inverse())
+	s.GetCamera().UpdateCamera()
+	triangles := faces(s.GetCamera().ViewProjection())
+	quad := object.NewEmpty(s, mgl.Vec3{})
+	quad.SetFaces([]FaceData{{Face: triangles[0], Color: red}, {Face: triangles[1], Color: red}})
+	quad.SetRotation(mgl.QuatRotate(angle, mgl.Vec3{0, 0, 1}))
+	quad.SetOpacity(opacity)
+
+	img := s.Render()
+	pixels := make([]color.RGBA, 0, testWidth*testHeight)
+	count := 0
+	for y := 0; y < testHeight; y++ {
+		for x := 0; x < testWidth; x++ {
+			pixel := img.RGBAAt(x, y)
+			pixels = append(pixels, pixel)
+			if pixel != white {
+				count++
+			}
+		}
+	}
+	return pixels, count
+}
+
+// TestEdgeOutlinesNearFar checks that the depth edges don't change with the depth mode and the near and far plane
+func TestEdgeOutlinesNearFar(t *testing.T) {
+	outlinePixels := func(mode DepthMode, configure func(camera CameraInterface)) int {
+		s, _ := newTestScene(t)
+		// A second cube behind the first one gives depth edges inside the silhouette
+		object.NewCube(3, mgl.Vec3{1, -1, -4}, mgl.QuatRotate(0.7, mgl.Vec3{1, 1, 0}.Normalize()), red, s)
+		s.GetCamera().SetDepthMode(mode)
+		configure(s.GetCamera())
+		s.SetRenderEdgeOutline(true)
+		img := s.Render()
+		count := 0
+		for y := 0; y < testHeight; y++ {
+			for x := 0; x < testWidth; x++ {
+				if img.RGBAAt(x, y) == (color.RGBA{A: 255}) {
+					count++
+				}
+			}
+		}
+		return count
+	}
+
+	want := outlinePixels(DepthStandard, func(CameraInterface) {})
+	if want == 0 {
+		t.Fatal("no outline pixels with the default camera")
+	}
+	for _, mode := range []DepthMode{DepthStandard, DepthReversed, DepthLogarithmic} {
+		for name, configure := range map[string]func(camera CameraInterface){
+			"default":       func(CameraInterface) {},
+			"auto near far": func(camera CameraInterface) { camera.SetAutoNearFar(true) },
+			"near 1":        func(camera CameraInterface) { camera.SetNearFar(1, 100) },
+			"near 0.001":    func(camera CameraInterface) { camera.SetNearFar(0.001, 1e6) },
+		} {
+			if got := outlinePixels(mode, configure); got != want {
+				t.Errorf("mode %v, %s: %d outline pixels, want %d", mode, name, got, want)
+			}
+		}
+	}
+}
+
+// newCutoutQuad adds a square of size 3 at the height z facing the camera, with a texture that is transparent on its
+// left half and opaque green on its right half. The alpha cutoff discards the left half
+func newCutoutQuad(s *Scene, z float64) *object.Object {
+	img := image.NewRGBA(image.Rect(0, 0, 2, 1))
+	img.SetRGBA(1, 0, color.RGBA{G: 255, A: 255})
+	corners := [4]mgl.Vec3{{-1.5, -1.5, z}, {1.5, -1.5, z}, {1.5, 1.5, z}, {-1.5, 1.5, z}}
+	texCoords := [4]mgl.Vec2{{0, 1}, {1, 1}, {1, 0}, {0, 0}}
+	quad := object.NewEmpty(s, mgl.Vec3{})
+	quad.SetFaces([]FaceData{
+		{Face: [3]mgl.Vec3{corners[0], corners[1], corners[2]}, TexCoords: [3]mgl.Vec2{texCoords[0], texCoords[1], texCoords[2]}, TextureImage: img, HasTexture: true, Color: white},
+		{Face: [3]mgl.Vec3{corners[0], corners[2], corners[3]}, TexCoords: [3]mgl.Vec2{texCoords[0], texCoords[2], texCoords[3]}, TextureImage: img, HasTexture: true, Color: white},
+	})
+	quad.SetAlphaCutoff(0.5)
+	return quad
+}
+
+// TestAlphaCutoffWithoutColors checks that the holes of a cutout can be picked through when only the ID buffer is rendered
+func TestAlphaCutoffWithoutColors(t *testing.T) {
+	s, cube := newTestScene(t)
+	quad := newCutoutQuad(s, 3)
+	s.SetRenderFaceColors(false)
+	s.SetRenderIDBuffer(true)
+	s.Render()
+	// The quad covers the pixels from 14 to 50 horizontally, the cube behind it from 26 to 38
+	if result, ok := s.PickAt(28, testHeight/2); !ok || result.Object != cube {
+		t.Errorf("picked something else than the cube through the hole (quad: %v)", result.Object == quad)
+	}
+	if result, ok := s.PickAt(38, testHeight/2); !ok || result.Object != quad {
+		t.Errorf("picked something else than the quad on its opaque half (cube: %v)", result.Object == cube)
+	}
+}
+
+// TestAlphaCutoffShadow checks that light falls through the holes of a cutout
+func TestAlphaCutoffShadow(t *testing.T) {
+	s, _ := newTestScene(t)
+	newCutoutQuad(s, 3)
+	s.SetRenderLighting(true)
+	sun := light.NewDirectionalLight(mgl.Vec3{0, 0, -1}, color.White, 1, s)
+	sun.SetCastShadows(true)
+	img := s.Render()
+	// The cube is seen through the hole and lit by the light falling through it. If the whole quad cast a shadow,
+	// the cube would only get the ambient light
+	if got := img.RGBAAt(28, testHeight/2); got.R < 200 {
+		t.Errorf("pixel through the hole = %v, want lit red", got)
+	}
+	if got := img.RGBAAt(38, testHeight/2); got.G < 200 || got.R > got.G/2 {
+		t.Errorf("pixel on the opaque half = %v, want green", got)
+	}
+}
+
+// TestSetMaterialDefaults checks that a zero value material doesn't hide an object and nil restores a default material
+func TestSetMaterialDefaults(t *testing.T) {
+	s, cube := newTestScene(t)
+	cube.SetMaterial(&Material{})
+	if got := s.Render().RGBAAt(testWidth/2, testHeight/2); got != red {
+		t.Errorf("center pixel with a zero value material = %v, want %v", got, red)
+	}
+	cube.SetMaterial(nil)
+	cube.SetOpacity(0.5)
+	if got := s.Render().RGBAAt(testWidth/2, testHeight/2); got == red || got == white {
+		t.Errorf("center pixel with half opacity = %v, want red blended with white", got)
+	}
+}
+
+// TestGradientBackground checks the gradient endpoints and that the rows above and below the horizon blend towards them
+func TestGradientBackground(t *testing.T) {
+	top := color.RGBA{B: 255, A: 255}
+	horizon := color.RGBA{G: 255, A: 255}
+	bottom := color.RGBA{A: 255}
+	gradient := background.NewGradient(top, horizon, bottom)
+	for _, tc := range []struct {
+		direction mgl.Vec3
+		want      color.RGBA
+	}{{mgl.Vec3{0, 1, 0}, top}, {mgl.Vec3{0, 0, -1}, horizon}, {mgl.Vec3{0, -1, 0}, bottom}} {
+		if got := gradient.ColorAt(tc.direction); got != tc.want {
+			t.Errorf("color at %v = %v, want %v", tc.direction, got, tc.want)
+		}
+	}
+
+	s, _ := newTestScene(t)
+	s.SetBackground(gradient)
+	img := s.Render()
+	if got := img.RGBAAt(testWidth/2, 0); got.B == 0 || got.G == 0 {
+		t.Errorf("top pixel = %v, want the horizon blended towards the top color", got)
+	}
+	if got := img.RGBAAt(testWidth/2, testHeight-1); got.B != 0 || got.G == 0 || got.G == 255 {
+		t.Errorf("bottom pixel = %v, want the horizon blended towards the bottom color", got)
+	}
+}
+
+// TestShadowUnderOccluder checks that a cube between a light and the front of the red cube shadows the part behind it
+func TestShadowUnderOccluder(t *testing.T) {
+	s, _ := newTestScene(t)
+	s.SetRenderLighting(true)
+	// The light falls in from the front left. The occluder is left of the line of sight, so it only hides the left half
+	// of the front face from the light
+	object.NewCube(1, mgl.Vec3{-2, 0, 2}, mgl.QuatIdent(), white, s)
+	sun := light.NewDirectionalLight(mgl.Vec3{1, 0, -1}, color.White, 1, s)
+	sun.SetCastShadows(true)
+	img := s.Render()
+	// The front face is at a distance of 4, where a pixel is 1/6 of a unit wide
+	shadowed, lit := img.RGBAAt(testWidth/2-3, testHeight/2), img.RGBAAt(testWidth/2+3, testHeight/2)
+	if int(shadowed.R)+50 > int(lit.R) {
+		t.Errorf("pixel behind the occluder = %v, want darker than the lit pixel %v", shadowed, lit)
+	}
+}
+
+// TestDecalLayer checks that a decal in a higher layer is drawn over a coplanar face, even if it is a bit behind it
+func TestDecalLayer(t *testing.T) {
+	blue := color.RGBA{B: 255, A: 255}
+	for _, mode := range []AntiAliasingMode{AntiAliasingNone, AntiAliasingSupersampling} {
+		s, _ := newTestScene(t)
+		s.SetAntiAliasing(mode)
+		// The front face of the cube is at a height of 1
+		corners := [4]mgl.Vec3{{-0.5, -0.5, 1 - 1e-7}, {0.5, -0.5, 1 - 1e-7}, {0.5, 0.5, 1 - 1e-7}, {-0.5, 0.5, 1 - 1e-7}}
+		decal := object.NewEmpty(s, mgl.Vec3{})
+		decal.SetFaces([]FaceData{
+			{Face: [3]mgl.Vec3{corners[0], corners[1], corners[2]}, Color: blue},
+			{Face: [3]mgl.Vec3{corners[0], corners[2], corners[3]}, Color: blue},
+		})
+		if got := s.Render().RGBAAt(testWidth/2, testHeight/2); got != red {
+			t.Errorf("anti aliasing %v: center pixel without a layer = %v, want the cube in front", mode, got)
+		}
+		decal.SetLayer(1)
+		if got := s.Render().RGBAAt(testWidth/2, testHeight/2); got != blue {
+			t.Errorf("anti aliasing %v: center pixel with the decal in layer 1 = %v, want %v", mode, got, blue)
+		}
+	}
+}
+
+// TestDirectionalLight checks that a face turned towards a light is brighter than one turned away from it
+func TestDirectionalLight(t *testing.T) {
+	centerWithLight := func(direction mgl.Vec3) color.RGBA {
+		s, _ := newTestScene(t)
+		s.SetRenderLighting(true)
+		light.NewDirectionalLight(direction, color.White, 1, s)
+		return s.Render().RGBAAt(testWidth/2, testHeight/2)
+	}
+	// The camera sees the front face of the cube, which points to +Z
+	lit, unlit := centerWithLight(mgl.Vec3{0, 0, -1}), centerWithLight(mgl.Vec3{0, 0, 1})
+	if int(unlit.R)+50 > int(lit.R) {
+		t.Errorf("pixel facing the light = %v, want brighter than the pixel facing away %v", lit, unlit)
+	}
+}
+
+// loadObj writes an OBJ file with the lines and loads it as an object at the origin
+func loadObj(t *testing.T, s *Scene, lines string) *object.Object {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "model.obj")
+	if err := os.WriteFile(path, []byte(lines), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	obj, err := object.NewObjectFromObjFile(path, mgl.Vec3{}, mgl.QuatIdent(), 1, red, "", s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return obj
+}
+
+// TestObjVertexNormals checks that the vertex normals of an OBJ file are normalized and only used if every vertex of a face has one
+func TestObjVertexNormals(t *testing.T) {
+	s := NewScene(testWidth, testHeight)
+	t.Cleanup(s.Close)
+	obj := loadObj(t, s, `v 0 0 0
+v 1 0 0
+v 0 1 0
+vn 0 0 2
+f 1//1 2//1 3//1
+f 1 2 3
+`)
+	faces := obj.Faces()
+	if len(faces) != 2 {
+		t.Fatalf("got %d faces, want 2", len(faces))
+	}
+	if !faces[0].HasNormals || faces[0].Normals[1] != (mgl.Vec3{0, 0, 1}) {
+		t.Errorf("face with normals: normals = %v (has normals: %v), want the normalized +Z", faces[0].Normals, faces[0].HasNormals)
+	}
+	if faces[1].HasNormals {
+		t.Errorf("face without normals has normals %v", faces[1].Normals)
+	}
+}
+
+// TestObjVertexColors checks that vertex colors from 0 to 1 and from 0 to 255 are both read, and only used if every vertex of a face has one
+func TestObjVertexColors(t *testing.T) {
+	s := NewScene(testWidth, testHeight)
+	t.Cleanup(s.Close)
+	obj := loadObj(t, s, `v 0 0 0 1 0 0.5
+v 1 0 0 1 0 0.5
+v 0 1 0 1 0 0.5
+v 0 0 1 255 128 0
+v 1 0 1 255 128 0
+v 0 1 1 255 128 0
+v 1 1 1
+f 1 2 3
+f 4 5 6
+f 1 2 7
+`)
+	faces := obj.Faces()
+	if len(faces) != 3 {
+		t.Fatalf("got %d faces, want 3", len(faces))
+	}
+	for i, want := range []color.RGBA{{R: 255, B: 128, A: 255}, {R: 255, G: 128, A: 255}} {
+		if !faces[i].HasColors || faces[i].Colors[0] != want {
+			t.Errorf("face %d: vertex colors = %v (has colors: %v), want %v", i, faces[i].Colors, faces[i].HasColors, want)
+		}
+	}
+	if faces[2].HasColors {
+		t.Errorf("face with a vertex without a color has vertex colors %v", faces[2].Colors)
+	}
+}
+
+// TestTextureWrapAndMipmaps checks the repeat and mirrored wrapping and that a texture minified to one texel is averaged
+func TestTextureWrapAndMipmaps(t *testing.T) {
+	black := color.RGBA{A: 255}
+	img := image.NewRGBA(image.Rect(0, 0, 2, 2))
+	for i, c := range []color.RGBA{black, white, white, black} {
+		img.SetRGBA(i%2, i/2, c)
+	}
+	checker := texture.NewTexture(img)
+	checker.SetFilter(texture.FilterNearest)
+	// 1.25 lies in the left half of the second tile, which is mirrored when the wrapping is mirrored
+	for _, tc := range []struct {
+		mode texture.WrapMode
+		want color.RGBA
+	}{{texture.WrapRepeat, black}, {texture.WrapMirroredRepeat, white}} {
+		checker.SetWrap(tc.mode, tc.mode)
+		if got := checker.Sample(mgl.Vec2{1.25, 0.75}, 0); got != tc.want {
+			t.Errorf("wrap mode %v: sample at u 1.25 = %v, want %v", tc.mode, got, tc.want)
+		}
+	}
+
+	// One pixel covers the whole texture, which is the 1x1 level
+	lod := checker.LevelOfDetail(mgl.Vec2{1, 0}, mgl.Vec2{0, 1})
+	if lod != 1 {
+		t.Errorf("level of detail = %v, want 1", lod)
+	}
+	if got := checker.Sample(mgl.Vec2{0.25, 0.75}, lod); got.R < 120 || got.R > 135 {
+		t.Errorf("sample of the 1x1 level = %v, want gray", got)
+	}
+}
+
+// TestFogAmount checks how much white fog covers the front face of the cube at a distance of 4
+func TestFogAmount(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		mode   FogMode
+		amount float64
+	}{
+		{"linear from 3 to 5", FogLinear, 0.5},
+		{"exponential with density 0.25", FogExponential, 1 - math.Exp(-1)},
+		{"exponential squared with density 0.25", FogExponentialSquared, 1 - math.Exp(-1)},
+	} {
+		s, _ := newTestScene(t)
+		fog := NewFogSettings()
+		fog.Mode = tc.mode
+		fog.Color = white
+		fog.Start, fog.End, fog.Density = 3, 5, 0.25
+		s.SetFog(fog)
+		got := s.Render().RGBAAt(testWidth/2, testHeight/2)
+		// Red has no green, so the green channel is the fog amount
+		if want := tc.amount * 255; got.R != 255 || math.Abs(float64(got.G)-want) > 2 {
+			t.Errorf("%s: center pixel = %v, want red with a green of %.0f", tc.name, got, want)
+		}
+	}
+}
+
+// TestAmbientOcclusion checks that a floor is darkened where it meets a cube standing on it, but not further away,
+// and that the flat front face of the cube doesn't occlude itself
+func TestAmbientOcclusion(t *testing.T) {
+	s, _ := newTestScene(t)
+	s.SetBackgroundColor(color.RGBA{B: 255, A: 255})
+	// The camera looks down at the cube from the front
+	s.GetCamera().SetPosition(mgl.Vec3{0, 3, 5})
+	s.GetCamera().SetRotation(mgl.QuatRotate(math.Atan2(3, 5), mgl.Vec3{1, 0, 0}))
+	corners := [4]mgl.Vec3{{-4, -1, 4}, {4, -1, 4}, {4, -1, -4}, {-4, -1, -4}}
+	floor := object.NewEmpty(s, mgl.Vec3{})
+	floor.SetFaces([]FaceData{
+		{Face: [3]mgl.Vec3{corners[0], corners[1], corners[2]}, Color: white},
+		{Face: [3]mgl.Vec3{corners[0], corners[2], corners[3]}, Color: white},
+	})
+	s.SetRenderAmbientOcclusion(true)
+	img := s.Render()
+	if got := img.RGBAAt(21, 24); got.G > 240 || got.B != got.G {
+		t.Errorf("floor pixel next to the cube = %v, want darkened white", got)
+	}
+	if got := img.RGBAAt(testWidth/2, 42); got.G < 250 || got.B != got.G {
+		t.Errorf("floor pixel far from the cube = %v, want white", got)
+	}
+	if got := img.RGBAAt(testWidth/2, 26); got.R < 250 || got.G != 0 {
+		t.Errorf("pixel on the front face of the cube = %v, want red", got)
+	}
+}
+
+// TestToonBands checks that the light on a face is quantized into the bands of cel shading
+func TestToonBands(t *testing.T) {
+	for _, tc := range []struct {
+		bands int
+		level float64
+	}{{0, 0.6}, {2, 1}, {3, 0.5}, {4, 2.0 / 3}} {
+		s, cube := newTestScene(t)
+		s.SetRenderLighting(true)
+		s.SetAmbientLight(color.White, 0)
+		cube.Material().Specular = 0
+		cube.SetToonShading(tc.bands)
+		// The light reaches the front face at an angle with a cosine of 0.6
+		light.NewDirectionalLight(mgl.Vec3{-0.8, 0, -0.6}, color.White, 1, s)
+		got := s.Render().RGBAAt(testWidth/2, testHeight/2)
+		if want := 255 * tc.level * cube.Material().Diffuse; math.Abs(float64(got.R)-want) > 2 {
+			t.Errorf("%d bands: center pixel = %v, want a red of %.0f", tc.bands, got, want)
+		}
+	}
+}
+
+// TestPolylineCoverage checks that a polyline covers the pixels along it in its width, and is hidden behind faces
+func TestPolylineCoverage(t *testing.T) {
+	s, _ := newTestScene(t)
+	blue := color.RGBA{B: 255, A: 255}
+	// At a distance of 3 a pixel is 1/8 of a unit, so the lines span the pixels 24 to 40. The first one is
+	// in front of the cube in row 12 above it. The second one is behind the cube in the center row and sticks out on both sides
+	object.NewPolyline([]mgl.Vec3{{-1, 1.5, 2}, {1, 1.5, 2}}, blue, 3, WidthPixels, s)
+	object.NewPolyline([]mgl.Vec3{{-3, 0, -2}, {3, 0, -2}}, blue, 3, WidthPixels, s)
+	img := s.Render()
+	for _, tc := range []struct {
+		name string
+		x, y int
+		want color.RGBA
+	}{
+		{"on the line", testWidth / 2, 12, blue},
+		{"in the width", testWidth / 2, 13, blue},
+		{"beside the line", testWidth / 2, 16, white},
+		{"after the end", 44, 12, white},
+		{"behind the cube", testWidth / 2, testHeight / 2, red},
+		{"beside the cube", 24, testHeight / 2, blue},
+	} {
+		if got := img.RGBAAt(tc.x, tc.y); got != tc.want {
+			t.Errorf("pixel %s = %v, want %v", tc.name, got, tc.want)
+		}
+	}
+}
+
+// TestBillboardFacesCamera checks that a billboard looks the same from every side, because it turns with the camera
+func TestBillboardFacesCamera(t *testing.T) {
+	blue := color.RGBA{B: 255, A: 255}
+	img := image.NewRGBA(image.Rect(0, 0, 4, 4))
+	for i := 0; i < 16; i++ {
+		img.SetRGBA(i%4, i/4, blue)
+	}
+	var first *image.RGBA
+	// The camera circles around the cube, so the billboard above it stays at the same distance.
+	// Only the rows above the cube are compared, which looks different from the side
+	for _, angle := range []float64{0, math.Pi / 2, 3 * math.Pi / 4} {
+		s, _ := newTestScene(t)
+		eye := mgl.Vec3{5 * math.Sin(angle), 0, 5 * math.Cos(angle)}
+		s.GetCamera().SetPosition(eye)
+		s.GetCamera().SetRotation(mgl.QuatRotate(-angle, mgl.Vec3{0, 1, 0}))
+		object.NewBillboard(img, mgl.Vec3{0, 3, 0}, 8, WidthPixels, s)
+		rendered := s.Render()
+		if got := rendered.RGBAAt(testWidth/2, 10); got != blue {
+			t.Errorf("eye at %v: pixel at the billboard = %v, want %v", eye, got, blue)
+		}
+		if first == nil {
+			first = rendered
+			continue
+		}
+		for y := 0; y < 16; y++ {
+			for x := 0; x < testWidth; x++ {
+				if got, want := rendered.RGBAAt(x, y), first.RGBAAt(x, y); got != want {
+					t.Fatalf("eye at %v: pixel (%d, %d) = %v, want %v like from the front", eye, x, y, got, want)
+				}
+			}
+		}
+	}
+}
+
+// TestWireframeHidesDiagonals checks that the wireframe draws the outline of the front face of the cube,
+// but neither the diagonal between its two triangles nor the edges of the back face behind it
+func TestWireframeHidesDiagonals(t *testing.T) {
+	s, _ := newTestScene(t)
+	blue := color.RGBA{B: 255, A: 255}
+	wireframe := NewWireframeSettings()
+	wireframe.Enabled = true
+	wireframe.Color = blue
+	s.SetWireframe(wireframe)
+	img := s.Render()
+	// The front face covers the pixels from 26 to 38 horizontally and from 18 to 30 vertically
+	outline := false
+	for x := 24; x <= 28; x++ {
+		outline = outline || img.RGBAAt(x, testHeight/2) == blue
+	}
+	if !outline {
+		t.Errorf("no edge drawn at the left side of the front face")
+	}
+	for y := 21; y <= 27; y++ {
+		for x := 29; x <= 35; x++ {
+			if got := img.RGBAAt(x, y); got != red {
+				t.Fatalf("pixel (%d, %d) inside the front face = %v, want %v", x, y, got, red)
+			}
+		}
+	}
+}
@@ -0,0 +1,217 @@
+package texture
+
+import (
+	mgl "github.com/go-gl/mathgl/mgl64"
+	. "github.com/virus-rpi/ThreeDView/types"
+	"image"
+	"image/color"
+	"image/draw"
+	"math"
+	"sync"
+)
+
+// FilterMode defines how texels are combined when a texture is sampled
+type FilterMode int
+
+const (
+	FilterNearest  FilterMode = iota // Use the texel closest to the sample point
+	FilterBilinear                   // Blend the four texels around the sample point
+)
+
+// WrapMode defines how texture coordinates outside 0 to 1 are handled
+type WrapMode int
+
+const (
+	WrapClamp          WrapMode = iota // Coordinates are clamped to the edge of the texture
+	WrapRepeat                         // The texture is tiled
+	WrapMirroredRepeat                 // The texture is tiled and every second tile is mirrored
+)
+
+// Texture is an image with sampling settings. It implements image.Image so it can be used as FaceData.TextureImage
+type Texture struct {
+	image.Image
+	filter  FilterMode
+	wrapU   WrapMode
+	wrapV   WrapMode
+	mipmaps bool
+
+	levels     []*image.RGBA // Level 0 is the image itself, every further level has half the size
+	levelsOnce sync.Once
+}
+
+// NewTexture creates a texture with bilinear filtering, mipmaps and repeat wrapping.
+// The image is converted once so sampling is fast
+func NewTexture(img image.Image) *Texture {
+	return &Texture{
+		Image:   toRGBA(img),
+		filter:  FilterBilinear,
+		wrapU:   WrapRepeat,
+		wrapV:   WrapRepeat,
+		mipmaps: true,
+	}
+}
+
+// FromImage returns the image if it already is a texture. Otherwise, it wraps the image into a texture
+// that samples it without conversion using nearest filtering, no mipmaps and clamping to the edge
+func FromImage(img image.Image) *Texture {
+	if texture, ok := img.(*Texture); ok {
+		return texture
+	}
+	return &Texture{Image: img, filter: FilterNearest, wrapU: WrapClamp, wrapV: WrapClamp}
+}
+
+func (texture *Texture) Filter() FilterMode {
+	return texture.filter
+}
+
+// SetFilter sets how texels are combined when sampling
+func (texture *Texture) SetFilter(filter FilterMode) {
+	texture.filter = filter
+}
+
+func (texture *Texture) Wrap() (u, v WrapMode) {
+	return texture.wrapU, texture.wrapV
+}
+
+// SetWrap sets how texture coordinates outside 0 to 1 are handled in u and v direction
+func (texture *Texture) SetWrap(u, v WrapMode) {
+	texture.wrapU = u
+	texture.wrapV = v
+}
+
+func (texture *Texture) Mipmaps() bool {
+	return texture.mipmaps
+}
+
+// SetMipmaps sets whether smaller versions of the texture are used for distant or oblique surfaces.
+// The mipmaps are generated the first time they are needed
+func (texture *Texture) SetMipmaps(mipmaps bool) {
+	texture.mipmaps = mipmaps
+}
+
+// LevelOfDetail returns the mipmap level for the given derivatives of the texture coordinates per screen pixel
+func (texture *Texture) LevelOfDetail(dx, dy mgl.Vec2) float64 {
+	if !texture.mipmaps {
+		return 0
+	}
+	bounds := texture.Bounds()
+	size := mgl.Vec2{float64(bounds.Dx()), float64(bounds.Dy())}
+	lengthX := math.Hypot(dx.X()*size.X(), dx.Y()*size.Y())
+	lengthY := math.Hypot(dy.X()*size.X(), dy.Y()*size.Y())
+	footprint := math.Max(lengthX, lengthY)
+	if footprint <= 1 || math.IsNaN(footprint) {
+		return 0
+	}
+	return math.Log2(footprint)
+}
+
+// Sample returns the color of the texture at the texture coordinate. (0, 0) is the bottom left corner.
+// lod is the mipmap level from LevelOfDetail, 0 samples the full resolution image
+func (texture *Texture) Sample(texCoord mgl.Vec2, lod float64) color.RGBA {
+	if lod <= 0 || !texture.mipmaps {
+		return texture.sampleLevel(texture.Image, texCoord)
+	}
+	texture.levelsOnce.Do(texture.generateMipmaps)
+	maxLevel := float64(len(texture.levels) - 1)
+	if lod >= maxLevel {
+		return texture.sampleLevel(texture.levels[len(texture.levels)-1], texCoord)
+	}
+	if texture.filter == FilterNearest {
+		return texture.sampleLevel(texture.levels[int(math.Round(lod))], texCoord)
+	}
+	// Trilinear filtering between the two closest levels
+	level := int(lod)
+	t := lod - float64(level)
+	return LerpColor(texture.sampleLevel(texture.levels[level], texCoord), texture.sampleLevel(texture.levels[level+1], texCoord), t)
+}
+
+func (texture *Texture) sampleLevel(img image.Image, texCoord mgl.Vec2) color.RGBA {
+	bounds := img.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	if width == 0 || height == 0 {
+		return color.RGBA{}
+	}
+	x := texCoord.X() * float64(width)
+	y := (1.0 - texCoord.Y()) * float64(height) // Flip Y coordinate
+
+	if texture.filter == FilterNearest {
+		return texelAt(img, wrap(int(math.Floor(x)), width, texture.wrapU), wrap(int(math.Floor(y)), height, texture.wrapV))
+	}
+
+	// Sample relative to texel centers
+	x -= 0.5
+	y -= 0.5
+	x0, y0 := math.Floor(x), math.Floor(y)
+	tx, ty := x-x0, y-y0
+	left, right := wrap(int(x0), width, texture.wrapU), wrap(int(x0)+1, width, texture.wrapU)
+	top, bottom := wrap(int(y0), height, texture.wrapV), wrap(int(y0)+1, height, texture.wrapV)
+	return LerpColor(
+		LerpColor(texelAt(img, left, top), texelAt(img, right, top), tx),
+		LerpColor(texelAt(img, left, bottom), texelAt(img, right, bottom), tx),
+		ty,
+	)
+}
+
+// generateMipmaps creates all mipmap levels down to a size of 1x1 by averaging 2x2 texels
+func (texture *Texture) generateMipmaps() {
+	level := toRGBA(texture.Image)
+	texture.levels = []*image.RGBA{level}
+	for level.Bounds().Dx() > 1 || level.Bounds().Dy() > 1 {
+		width, height := max(level.Bounds().Dx()/2, 1), max(level.Bounds().Dy()/2, 1)
+		next := image.NewRGBA(image.Rect(0, 0, width, height))
+		for y := 0; y < height; y++ {
+			for x := 0; x < width; x++ {
+				var r, g, b, a int
+				for _, offset := range [4]image.Point{{0, 0}, {1, 0}, {0, 1}, {1, 1}} {
+					c := texelAt(level, min(x*2+offset.X, level.Bounds().Dx()-1), min(y*2+offset.Y, level.Bounds().Dy()-1))
+					r += int(c.R)
+					g += int(c.G)
+					b += int(c.B)
+					a += int(c.A)
+				}
+				i := next.PixOffset(x, y)
+				next.Pix[i], next.Pix[i+1], next.Pix[i+2], next.Pix[i+3] = uint8(r/4), uint8(g/4), uint8(b/4), uint8(a/4)
+			}
+		}
+		texture.levels = append(texture.levels, next)
+		level = next
+	}
+}
+
+// wrap maps a texel index into the range 0 to size-1 with the given wrap mode
+func wrap(i, size int, mode WrapMode) int {
+	switch mode {
+	case WrapRepeat:
+		return ((i % size) + size) % size
+	case WrapMirroredRepeat:
+		period := size * 2
+		i = ((i % period) + period) % period
+		if i >= size {
+			return period - 1 - i
+		}
+		return i
+	default:
+		return min(max(i, 0), size-1)
+	}
+}
+
+// texelAt returns the premultiplied color of a texel relative to the top left corner of the image
+func texelAt(img image.Image, x, y int) color.RGBA {
+	bounds := img.Bounds()
+	if rgba, ok := img.(*image.RGBA); ok {
+		i := rgba.PixOffset(bounds.Min.X+x, bounds.Min.Y+y)
+		return color.RGBA{R: rgba.Pix[i], G: rgba.Pix[i+1], B: rgba.Pix[i+2], A: rgba.Pix[i+3]}
+	}
+	return color.RGBAModel.Convert(img.At(bounds.Min.X+x, bounds.Min.Y+y)).(color.RGBA)
+}
+
+// toRGBA converts an image to *image.RGBA with the origin at (0, 0)
+func toRGBA(img image.Image) *image.RGBA {
+	if rgba, ok := img.(*image.RGBA); ok && rgba.Bounds().Min == (image.Point{}) {
+		return rgba
+	}
+	bounds := img.Bounds()
+	rgba := image.NewRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	draw.Draw(rgba, rgba.Bounds(), img, bounds.Min, draw.Src)
+	return rgba
+}
@@ -1,6 +1,9 @@
 package types
 
-import mgl "github.com/go-gl/mathgl/mgl64"
+import (
+	mgl "github.com/go-gl/mathgl/mgl64"
+	"math"
+)
 
 type AABB struct {
 	Min mgl.Vec3
@@ -23,3 +26,25 @@ func (a *AABB) Center() mgl.Vec3 {
 func (a *AABB) Size() mgl.Vec3 {
 	return a.Max.Sub(a.Min)
 }
+
+// Corners returns the eight corners of the AABB
+func (a *AABB) Corners() [8]mgl.Vec3 {
+	var corners [8]mgl.Vec3
+	for i := range corners {
+		for axis := 0; axis < 3; axis++ {
+			corners[i][axis] = a.Min[axis]
+			if i&(1<<axis) != 0 {
+				corners[i][axis] = a.Max[axis]
+			}
+		}
+	}
+	return corners
+}
+
+// Extend grows the AABB so it also contains the point
+func (a *AABB) Extend(point mgl.Vec3) {
+	for axis := 0; axis < 3; axis++ {
+		a.Min[axis] = math.Min(a.Min[axis], point[axis])
+		a.Max[axis] = math.Max(a.Max[axis], point[axis])
+	}
+}
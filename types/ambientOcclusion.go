@@ -0,0 +1,23 @@
+package types
+
+// AmbientOcclusionSettings configures the screen space ambient occlusion that darkens creases and contact areas
+type AmbientOcclusionSettings struct {
+	Radius         Unit    // The radius around every point in which geometry occludes it, in world units
+	Samples        int     // The number of samples per pixel. More samples give less noise but are slower
+	Intensity      float64 // How strong the occlusion darkens pixels. 1 is physically plausible, higher values exaggerate it
+	Bias           Unit    // Depth difference below which samples don't count as occluded, prevents self occlusion of flat surfaces
+	BlurRadius     int     // The radius in pixels of the depth aware blur that removes the sampling noise. 0 disables the blur
+	HalfResolution bool    // Whether the occlusion is calculated at half the resolution, which is about four times faster
+}
+
+// NewAmbientOcclusionSettings returns ambient occlusion settings that work well for objects a few units large
+func NewAmbientOcclusionSettings() AmbientOcclusionSettings {
+	return AmbientOcclusionSettings{
+		Radius:         0.5,
+		Samples:        12,
+		Intensity:      1.5,
+		Bias:           0.02,
+		BlurRadius:     2,
+		HalfResolution: true,
+	}
+}
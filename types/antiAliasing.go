@@ -0,0 +1,10 @@
+package types
+
+// AntiAliasingMode defines how jagged edges are smoothed
+type AntiAliasingMode int
+
+const (
+	AntiAliasingNone          AntiAliasingMode = iota // Edges are not smoothed
+	AntiAliasingFXAA                                  // Edges are found by luminance contrast after rendering and blurred along their direction. Cheap, but can soften textures
+	AntiAliasingSupersampling                         // Every pixel is rendered from an ordered grid of samples that are averaged. Expensive, but exact
+)
@@ -0,0 +1,25 @@
+package types
+
+import (
+	mgl "github.com/go-gl/mathgl/mgl64"
+	"image"
+	"image/color"
+)
+
+// BillboardData is an image that faces the camera, drawn at a position in world space over the rendered scene
+type BillboardData struct {
+	Image       image.Image // The premultiplied image
+	Position    mgl.Vec3    // The position in world space the billboard is anchored to
+	Size        float64     // The height of the image in pixels or world units. 0 draws the image with its own size in pixels
+	SizeMode    WidthMode   // Whether the size is in pixels or world units
+	Offset      mgl.Vec2    // The distance in pixels from the projected position to the pivot of the image, +Y is down
+	Pivot       mgl.Vec2    // The point of the image that is placed at the offset, from (0, 0) top left to (1, 1) bottom right
+	DepthTest   bool        // Whether faces closer to the camera than the position hide the billboard
+	LeaderColor color.Color // The color of a line from the position to the offset pivot, nil for no line
+}
+
+// BillboardObject is implemented by objects that are drawn as camera facing images, like sprites and text labels
+type BillboardObject interface {
+	// Billboards returns the billboards of the object with their positions in world space
+	Billboards() []BillboardData
+}
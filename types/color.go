@@ -0,0 +1,27 @@
+package types
+
+import (
+	mgl "github.com/go-gl/mathgl/mgl64"
+	"image/color"
+	"math"
+)
+
+// ColorToVec3 converts a color to a vector with the red, green and blue channel in the range 0 to 1
+func ColorToVec3(c color.Color) mgl.Vec3 {
+	if c == nil {
+		return mgl.Vec3{}
+	}
+	r, g, b, _ := c.RGBA()
+	return mgl.Vec3{float64(r) / 0xffff, float64(g) / 0xffff, float64(b) / 0xffff}
+}
+
+// LerpColor blends linearly from a to b, with t clamped to the range 0 (a) to 1 (b)
+func LerpColor(a, b color.RGBA, t float64) color.RGBA {
+	t = math.Max(0, math.Min(1, t))
+	return color.RGBA{
+		R: uint8(float64(a.R) + (float64(b.R)-float64(a.R))*t + 0.5),
+		G: uint8(float64(a.G) + (float64(b.G)-float64(a.G))*t + 0.5),
+		B: uint8(float64(a.B) + (float64(b.B)-float64(a.B))*t + 0.5),
+		A: uint8(float64(a.A) + (float64(b.A)-float64(a.A))*t + 0.5),
+	}
+}
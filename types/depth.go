@@ -0,0 +1,103 @@
+package types
+
+import (
+	mgl "github.com/go-gl/mathgl/mgl64"
+	"math"
+)
+
+// DepthMode defines how the distance from the camera is stored in the depth buffer
+type DepthMode int
+
+const (
+	DepthStandard    DepthMode = iota // The NDC z of an OpenGL style projection from -1 (near) to 1 (far). Most of the precision is close to the near plane
+	DepthReversed                     // Reversed-Z: the NDC z goes from -1 (near) to 0 (far), with the sign flipped so closer is still smaller. Floating point values are densest close to 0, which evens out the precision over the distance
+	DepthLogarithmic                  // The logarithm of the distance in front of the camera, which gives the same relative precision at every distance
+)
+
+// DefaultNear is the distance of the near plane of a new camera
+const DefaultNear Unit = 0.1
+
+// DepthRange is the depth mode and the distances of the near and far plane of a camera.
+// It defines the projection and how the values in the depth buffer relate to the distance from the camera.
+// In every mode smaller depth buffer values are closer to the camera
+type DepthRange struct {
+	Mode DepthMode
+	Near Unit // The distance of the near plane, has to be larger than 0
+	Far  Unit // The distance of the far plane, math.Inf(1) for no far plane
+}
+
+// coefficients returns a and b of the projected NDC z = a + b / w of a point with the clip space W w
+func (depthRange DepthRange) coefficients() (a, b float64) {
+	near, far := float64(depthRange.Near), float64(depthRange.Far)
+	infinite := math.IsInf(far, 1)
+	if depthRange.Mode == DepthReversed {
+		if infinite {
+			return 0, -near
+		}
+		return near / (far - near), -near * far / (far - near)
+	}
+	if infinite {
+		return 1, -2 * near
+	}
+	return (far + near) / (far - near), -2 * far * near / (far - near)
+}
+
+// Projection returns the perspective projection matrix for the field of view and aspect ratio
+func (depthRange DepthRange) Projection(fov Radians, aspectRatio float64) mgl.Mat4 {
+	f := 1 / math.Tan(float64(fov)/2)
+	a, b := depthRange.coefficients()
+	return mgl.Mat4{
+		f / aspectRatio, 0, 0, 0,
+		0, f, 0, 0,
+		0, 0, -a, -1,
+		0, 0, b, 0,
+	}
+}
+
+// FarNDC returns the NDC z of the far plane. Geometry with a larger NDC z is clipped
+func (depthRange DepthRange) FarNDC() float64 {
+	if depthRange.Mode == DepthReversed {
+		return 0
+	}
+	return 1
+}
+
+// Depth returns the value stored in the depth buffer for a point with the NDC z and clip space W
+func (depthRange DepthRange) Depth(ndcZ, w float64) float64 {
+	if depthRange.Mode == DepthLogarithmic {
+		return math.Log(w / float64(depthRange.Near))
+	}
+	return ndcZ
+}
+
+// ViewDepth returns the clip space W of a depth buffer value, which is the distance in front of the camera along its view direction.
+// An empty depth buffer value (+Inf) returns +Inf
+func (depthRange DepthRange) ViewDepth(depth float64) float64 {
+	if math.IsInf(depth, 1) {
+		return math.Inf(1)
+	}
+	if depthRange.Mode == DepthLogarithmic {
+		return float64(depthRange.Near) * math.Exp(depth)
+	}
+	a, b := depthRange.coefficients()
+	return b / (depth - a)
+}
+
+// NDC returns the NDC z of a depth buffer value, which can be unprojected with the inverse view projection matrix
+func (depthRange DepthRange) NDC(depth float64) float64 {
+	if depthRange.Mode == DepthLogarithmic {
+		a, b := depthRange.coefficients()
+		return a + b/depthRange.ViewDepth(depth)
+	}
+	return depth
+}
+
+// Offset returns the depth buffer value of a point moved along the view direction by bias times its distance from the camera.
+// Negative values move it closer
+func (depthRange DepthRange) Offset(depth, bias float64) float64 {
+	if depthRange.Mode == DepthLogarithmic {
+		return depth + math.Log1p(bias)
+	}
+	a, _ := depthRange.coefficients()
+	return a + (depth-a)/(1+bias)
+}
@@ -8,22 +8,31 @@ import (
 )
 
 type ClippedTriangle struct {
-	Points     [3]mgl.Vec2
-	Z          [3]float64
-	TexCoords  [3]mgl.Vec2
-	HasTexture bool
+	Points      [3]mgl.Vec2
+	Z           [3]float64
+	W           [3]float64 // Clip space W of each point, used for perspective correct interpolation
+	TexCoords   [3]mgl.Vec2
+	HasTexture  bool
+	Barycentric [3]mgl.Vec3 // Weights of the original face vertices for each point
 }
 
 // FaceData represents a face in 3D space
 type FaceData struct {
-	Face         [3]mgl.Vec3 // The Face in 3D space as a list of vectors
-	Color        color.Color // The Color of the Face
-	Distance     Unit        // The Distance of the Face from the camera 3d world space
-	TextureImage image.Image // The texture image for the face (nil if no texture)
-	TexCoords    [3]mgl.Vec2 // Texture coordinates for each vertex
-	HasTexture   bool        // Whether this face has texture information
-	bounds       *AABB       // Cached bounds, nil if needs recalculation
-	needsRecalc  bool        // Flag indicating if bounds need recalculation
+	Face         [3]mgl.Vec3     // The Face in 3D space as a list of vectors
+	Color        color.Color     // The Color of the Face
+	Colors       [3]color.Color  // Color of each vertex, interpolated across the face instead of Color
+	HasColors    bool            // Whether this face has per-vertex colors
+	Distance     Unit            // The Distance of the Face from the camera 3d world space
+	TextureImage image.Image     // The texture image for the face (nil if no texture)
+	TexCoords    [3]mgl.Vec2     // Texture coordinates for each vertex
+	HasTexture   bool            // Whether this face has texture information
+	Normals      [3]mgl.Vec3     // Normal vector for each vertex
+	HasNormals   bool            // Whether this face has per-vertex normals
+	Material     *Material       // The material of the face (nil to use the material of the object)
+	Object       ObjectInterface // The object the face belongs to, set when the face is added to the octree
+	Index        int             // The index of the face in the faces of its object
+	bounds       *AABB           // Cached bounds, nil if needs recalculation
+	needsRecalc  bool            // Flag indicating if bounds need recalculation
 }
 
 // GetBounds returns the AABB for the face, recalculating if necessary
@@ -66,6 +75,9 @@ func (faceData *FaceData) Rotate(pivot mgl.Vec3, rotation mgl.Quat) {
 		p := faceData.Face[i].Sub(pivot)
 		p = rotation.Rotate(p)
 		faceData.Face[i] = p.Add(pivot)
+		if faceData.HasNormals {
+			faceData.Normals[i] = rotation.Rotate(faceData.Normals[i])
+		}
 	}
 	faceData.needsRecalc = true
 }
@@ -94,3 +106,56 @@ func (faceData *FaceData) Normal() mgl.Vec3 {
 	normal := edge1.Cross(edge2).Normalize()
 	return normal
 }
+
+// VertexNormal returns the normal vector at a vertex. Falls back to the face normal if the face has no per-vertex normals
+func (faceData *FaceData) VertexNormal(i int) mgl.Vec3 {
+	if faceData.HasNormals {
+		return faceData.Normals[i]
+	}
+	return faceData.Normal()
+}
+
+// VertexColor returns the color of a vertex. Falls back to the face color if the face has no per-vertex colors
+func (faceData *FaceData) VertexColor(i int) color.Color {
+	if faceData.HasColors && faceData.Colors[i] != nil {
+		return faceData.Colors[i]
+	}
+	return faceData.Color
+}
+
+// AverageColor returns the average of the vertex colors, or the face color if the face has no per-vertex colors.
+// Vertices without a color count as opaque black
+func (faceData *FaceData) AverageColor() color.Color {
+	if !faceData.HasColors {
+		return faceData.Color
+	}
+	var total [4]uint32
+	for i := range faceData.Colors {
+		c := faceData.VertexColor(i)
+		if c == nil {
+			c = color.Black
+		}
+		r, g, b, a := c.RGBA()
+		total[0], total[1], total[2], total[3] = total[0]+r, total[1]+g, total[2]+b, total[3]+a
+	}
+	return color.RGBA64{R: uint16(total[0] / 3), G: uint16(total[1] / 3), B: uint16(total[2] / 3), A: uint16(total[3] / 3)}
+}
+
+// IsCulled returns whether the face is skipped with the cull mode when seen from the camera position
+func (faceData *FaceData) IsCulled(mode CullMode, cameraPosition mgl.Vec3) bool {
+	if mode == CullNone {
+		return false
+	}
+	facesCamera := faceData.Normal().Dot(cameraPosition.Sub(faceData.Face[0])) > 0
+	if mode == CullBack {
+		return !facesCamera
+	}
+	return facesCamera
+}
+
+// PickResult describes the face that is visible at a pixel
+type PickResult struct {
+	Object    ObjectInterface // The object the face belongs to
+	FaceIndex int             // The index of the face in the faces of the object
+	Position  mgl.Vec3        // The point on the face in world space that is visible at the center of the pixel
+}
@@ -0,0 +1,42 @@
+package types
+
+import "image/color"
+
+// FogMode defines how the fog density grows with the distance from the camera
+type FogMode int
+
+const (
+	FogNone               FogMode = iota // No distance fog
+	FogLinear                            // Fog grows linearly between a start and an end distance
+	FogExponential                       // Fog grows exponentially with the distance and density
+	FogExponentialSquared                // Fog grows with the square of the distance and density, so close objects stay clearer
+)
+
+// FogSettings configures the fog that blends pixels towards a fog color depending on their distance from the camera.
+// Pixels without geometry keep the background color, so a fog color equal to the background color fades objects into it
+type FogSettings struct {
+	Mode    FogMode
+	Color   color.Color // The color of the fog. nil uses the background color, or the background behind every pixel if one is set
+	Start   Unit        // The distance at which linear fog starts
+	End     Unit        // The distance at which linear fog completely hides objects
+	Density float64     // The density of exponential fog
+
+	HeightFog        bool    // Whether fog is added that is dense at low heights and thins out above, like mist over terrain
+	HeightFogBase    Unit    // The height at which the height fog has its full density
+	HeightFogDensity float64 // The density of the height fog at its base height
+	HeightFogFalloff float64 // How fast the height fog thins out with the height above its base
+}
+
+// NewFogSettings returns disabled fog in the background color. Once a mode is set, linear fog starts at 10 units and
+// hides objects at 100 units, exponential fog has a density of 0.02, and height fog is densest at height 0 and thins out above
+func NewFogSettings() FogSettings {
+	return FogSettings{
+		Mode:             FogNone,
+		Start:            10,
+		End:              100,
+		Density:          0.02,
+		HeightFogBase:    0,
+		HeightFogDensity: 0.05,
+		HeightFogFalloff: 0.5,
+	}
+}
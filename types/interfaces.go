@@ -17,6 +17,34 @@ type ObjectInterface interface {
 	SetWidget(widget ThreeDWidgetInterface)
 }
 
+// OutlinedObject is implemented by objects with an own outline color
+type OutlinedObject interface {
+	// OutlineColor returns the color of the outlines of the object or nil to use the default color
+	OutlineColor() color.Color
+}
+
+type LightInterface interface {
+	// Illuminate returns the normalized direction from the point towards the light
+	// and the light color scaled by intensity and attenuation at that point
+	Illuminate(point mgl.Vec3) (direction mgl.Vec3, radiance mgl.Vec3)
+}
+
+// ShadowLight is implemented by lights that can cast shadows
+type ShadowLight interface {
+	LightInterface
+	// ShadowSettings returns how the shadow map of the light is rendered and sampled
+	ShadowSettings() ShadowSettings
+	// ShadowViewProjection returns the matrix that maps world space to the clip space of the shadow map, so that the map covers the bounds.
+	// Returns false if the light can't cast shadows onto the bounds
+	ShadowViewProjection(bounds AABB) (mgl.Mat4, bool)
+}
+
+// BackgroundInterface is drawn behind all objects instead of the background color
+type BackgroundInterface interface {
+	// ColorAt returns the premultiplied color of the background seen in a normalized direction in world space
+	ColorAt(direction mgl.Vec3) color.RGBA
+}
+
 type Controller interface {
 	SetCamera(cam CameraInterface)
 }
@@ -24,9 +52,14 @@ type Controller interface {
 type CameraInterface interface {
 	GetVisibleFaces() chan FaceData
 	ClipAndProjectFace(face FaceData, texCoords ...[3]mgl.Vec2) []ClippedTriangle
+	ClipAndProjectLine(start, end mgl.Vec3) (ClippedLine, bool)
+	Project(point mgl.Vec3) mgl.Vec2
 	UnProject(point2d mgl.Vec2, distance Unit) mgl.Vec3
+	ViewProjection() mgl.Mat4
 	BuildOctree()
 	RebuildOctree()
+	// ForEachSceneFace calls the callback with every world space face in the octree and returns their bounds
+	ForEachSceneFace(callback func(face FaceData)) *AABB
 	UpdateCamera()
 	Controller() Controller
 	SetController(controller Controller)
@@ -36,6 +69,10 @@ type CameraInterface interface {
 	SetRotation(rotation mgl.Quat)
 	Fov() Radians
 	SetFov(fov Degrees)
+	DepthRange() DepthRange
+	SetNearFar(near, far Unit)
+	SetAutoNearFar(auto bool)
+	SetDepthMode(mode DepthMode)
 }
 
 type ThreeDWidgetInterface interface {
@@ -43,14 +80,23 @@ type ThreeDWidgetInterface interface {
 	GetWidth() Pixel
 	GetHeight() Pixel
 	GetBackgroundColor() color.Color
+	GetBackground() BackgroundInterface
 	GetRenderFaceColors() bool
 	GetRenderTextures() bool
 	GetRenderFaceOutlines() bool
-	GetRenderEdgeOutlines() bool
-	GetRenderZBuffer() bool
-	GetRenderPseudoShading() bool
+	GetRenderLighting() bool
+	GetRenderIDBuffer() bool
+	GetOutlineSettings() OutlineSettings
+	GetFog() FogSettings
+	GetAmbientOcclusionSettings() AmbientOcclusionSettings
+	GetWireframe() WireframeSettings
+	GetAntiAliasing() AntiAliasingMode
+	GetSupersamplingFactor() int
 	GetObjects() []ObjectInterface
 	AddObject(obj ObjectInterface)
+	GetLights() []LightInterface
+	AddLight(light LightInterface)
+	GetAmbientLight() (color.Color, float64)
 	SetCamera(camera CameraInterface)
 	GetCamera() CameraInterface
 }
@@ -0,0 +1,83 @@
+package types
+
+import (
+	"image"
+	"image/color"
+)
+
+// ShadingMode defines how light is calculated across a face
+type ShadingMode int
+
+const (
+	ShadingFlat    ShadingMode = iota // Light is calculated once per face
+	ShadingGouraud                    // Light is calculated per vertex and interpolated across the face
+	ShadingPhong                      // Normals are interpolated across the face and light is calculated per pixel
+)
+
+// CullMode defines which faces are skipped depending on which side faces the camera.
+// The front side is the one the counter-clockwise winding (the face normal) points to
+type CullMode int
+
+const (
+	CullNone  CullMode = iota // Both sides are rendered, for open meshes like planes
+	CullBack                  // Faces pointing away from the camera are skipped, for closed meshes
+	CullFront                 // Faces pointing towards the camera are skipped, for example to see the inside of a mesh
+)
+
+// Material describes how a surface reacts to light
+type Material struct {
+	Diffuse   float64     // Factor for the diffuse (Lambertian) light
+	Specular  float64     // Strength of the specular (Blinn-Phong) highlight. 0 disables highlights
+	Shininess float64     // Blinn-Phong exponent. Higher values give smaller and sharper highlights
+	Shading   ShadingMode // How light is calculated across a face. Faces without per-vertex normals always look flat
+
+	Opacity     float64 // The alpha of the face color or texture is multiplied with this. Faces with an opacity below 1 are blended, so 0 hides them
+	Transparent bool    // Whether the face is always blended with what is behind it, for example for textures with translucent parts
+	AlphaCutoff float64 // Pixels with an alpha below this value (0 to 1) are discarded, for cutouts like foliage. 0 disables the alpha test
+
+	Cull CullMode // Which side of the faces is skipped. Default is CullNone so faces are double-sided
+
+	CastShadows    bool // Whether the faces are drawn into the shadow maps of lights, so they cast shadows onto other faces
+	ReceiveShadows bool // Whether the faces are darkened where the shadow of other faces falls on them
+
+	ToonBands int         // The number of brightness bands the light is quantized into for a cel shaded look. 0 disables cel shading
+	ToonRamp  image.Image // A ramp the light is looked up in instead of using bands, read along its middle row from unlit (left) to fully lit (right)
+
+	DepthBias      float64 // Moves the faces along the view direction by this fraction of their distance before the depth test. Negative values pull them towards the camera, so markings on a surface are drawn over it
+	DepthSlopeBias float64 // Like DepthBias, multiplied with how much the distance of a face changes per pixel relative to its distance, so faces seen at a grazing angle are moved further
+	Layer          int     // Where faces are at the same depth, the face with the higher layer is drawn over the other one no matter the draw order
+}
+
+// IsTransparent returns whether faces with this material and the given color have to be blended with what is behind them
+func (material *Material) IsTransparent(c color.Color) bool {
+	if material.Transparent || material.Opacity < 1 {
+		return true
+	}
+	if c == nil {
+		return false
+	}
+	_, _, _, a := c.RGBA()
+	return a < 0xffff
+}
+
+// IsToon returns whether faces with this material are cel shaded
+func (material *Material) IsToon() bool {
+	return material.ToonBands > 0 || material.ToonRamp != nil
+}
+
+// NewMaterial creates a new opaque material with a full diffuse term and a weak highlight.
+// Materials should always be created with this so all factors have sensible defaults
+func NewMaterial() *Material {
+	return &Material{
+		Diffuse:        1,
+		Specular:       0.25,
+		Shininess:      32,
+		Shading:        ShadingGouraud,
+		Opacity:        1,
+		CastShadows:    true,
+		ReceiveShadows: true,
+	}
+}
+
+// DefaultMaterial is used for faces that have no material assigned
+var DefaultMaterial = NewMaterial()
@@ -0,0 +1,33 @@
+package types
+
+import "image/color"
+
+// OutlineSettings configures the edge outline renderer. Edges are found in the depth, normal and ID buffer of a frame
+type OutlineSettings struct {
+	DepthEdges  bool // Whether edges are drawn where the depth changes abruptly, like silhouettes
+	NormalEdges bool // Whether edges are drawn where the surface normal changes abruptly, like creases between faces at similar depth
+	ObjectEdges bool // Whether edges are drawn where one object ends and another one begins
+
+	DepthThreshold       float64 // Minimum gradient of the normalized logarithmic depth for a depth edge
+	DepthModulation      float64 // How much the depth threshold grows with the distance, so far away surfaces get less edges
+	GrazingAnglePower    float64 // How fast the depth threshold is lowered for surfaces seen at a grazing angle
+	GrazingAngleHardness float64 // How sharp the transition of the grazing angle threshold is (0 to 1)
+	NormalThreshold      Degrees // Minimum angle between the normals of neighbouring pixels for a normal edge
+
+	Thickness int         // The number of pixels the outline is extended by in every direction. 0 draws one pixel wide lines
+	Color     color.Color // The color of outlines of objects without an own outline color
+}
+
+// NewOutlineSettings returns outline settings that detect depth edges and draw black outlines
+func NewOutlineSettings() OutlineSettings {
+	return OutlineSettings{
+		DepthEdges:           true,
+		DepthThreshold:       0.05,
+		DepthModulation:      0.1,
+		GrazingAnglePower:    5.0,
+		GrazingAngleHardness: 0.5,
+		NormalThreshold:      30,
+		Thickness:            1,
+		Color:                color.Black,
+	}
+}
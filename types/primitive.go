@@ -0,0 +1,49 @@
+package types
+
+import (
+	mgl "github.com/go-gl/mathgl/mgl64"
+	"image/color"
+)
+
+// PrimitiveKind defines how the points of a primitive are drawn
+type PrimitiveKind int
+
+const (
+	PrimitiveLineStrip PrimitiveKind = iota // Consecutive points are connected by lines
+	PrimitivePoints                         // Every point is drawn as a round dot
+)
+
+// WidthMode defines in which space the width of lines and points is measured
+type WidthMode int
+
+const (
+	WidthPixels WidthMode = iota // The width is in pixels, so lines look the same at every distance
+	WidthWorld                   // The width is in world units, so lines get thinner with the distance like faces
+)
+
+// PrimitiveData is a polyline or a set of points in world space that is drawn depth tested against the faces
+type PrimitiveData struct {
+	Kind      PrimitiveKind
+	Points    []mgl.Vec3    // The points in world space
+	Colors    []color.Color // The color of every point, interpolated along lines. nil uses Color for all points
+	Color     color.Color   // The color of all points without an own color
+	Width     float64       // The width of lines or the diameter of points
+	WidthMode WidthMode     // Whether the width is in pixels or world units
+	Dash      []float64     // Alternating lengths of dashes and gaps along lines, in the same space as the width. Empty draws solid lines
+	DepthBias float64       // The fraction of its distance every pixel is moved along the view direction before the depth test, like Material.DepthBias
+	Layer     int           // The layer that decides against faces at the same depth, like Material.Layer
+}
+
+// ClippedLine is a line segment clipped to the camera frustum and projected to screen space
+type ClippedLine struct {
+	Points [2]mgl.Vec2
+	Z      [2]float64
+	W      [2]float64 // Clip space W of each point, used for perspective correct interpolation
+	T      [2]float64 // Position of each point along the original segment from 0 (start) to 1 (end)
+}
+
+// PrimitiveObject is implemented by objects that are drawn as lines or points instead of faces
+type PrimitiveObject interface {
+	// Primitives returns the lines and points of the object in world space
+	Primitives() []PrimitiveData
+}
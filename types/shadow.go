@@ -0,0 +1,22 @@
+package types
+
+// ShadowSettings configures the shadow map of a light. The shadow map stores the depth of the scene seen from the light,
+// points that are further away from the light than the stored depth are in shadow
+type ShadowSettings struct {
+	Enabled   bool    // Whether the light casts shadows
+	MapSize   Pixel   // The width and height of the shadow map. Larger maps give sharper shadows but are slower
+	Bias      float64 // Distance in shadow map texels points are moved towards the light before the comparison, prevents surfaces from shadowing themselves
+	SlopeBias float64 // Additional bias in texels that grows with the angle between the surface and the light, for surfaces the light grazes
+	PCFRadius int     // The radius in texels around every point that is averaged to soften the shadow edges (percentage closer filtering). 0 gives hard edges
+}
+
+// NewShadowSettings returns disabled shadows with a 1024x1024 shadow map, a bias and slope bias of one texel,
+// and edges softened over a radius of one texel
+func NewShadowSettings() ShadowSettings {
+	return ShadowSettings{
+		MapSize:   1024,
+		Bias:      1,
+		SlopeBias: 1,
+		PCFRadius: 1,
+	}
+}
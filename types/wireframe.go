@@ -0,0 +1,40 @@
+package types
+
+import (
+	mgl "github.com/go-gl/mathgl/mgl64"
+	"image/color"
+)
+
+// WireframeSettings configures the wireframe that draws the edges of all meshes with hidden line removal.
+// Edges shared by two faces are drawn once, so quads don't show their diagonals if CreaseAngle hides flat edges
+type WireframeSettings struct {
+	Enabled     bool
+	Color       color.Color // The color of the visible edges. nil draws black edges over face colors, or the face color without them
+	Width       float64     // The width of the edges in pixels
+	CreaseAngle Degrees     // Edges between faces that meet at a smaller angle are hidden, except silhouettes and open edges. 0 only hides the edges inside flat polygons
+	ShowHidden  bool        // Whether edges hidden behind faces are drawn dashed
+	HiddenColor color.Color // The color of the hidden edges, nil for the color of the visible edges
+	HiddenDash  []float64   // Alternating lengths of dashes and gaps of the hidden edges in pixels
+}
+
+// NewWireframeSettings returns a disabled wireframe of 1 pixel wide edges. The crease angle of 0 only hides the edges
+// inside flat polygons, and hidden edges are drawn with 4 pixel dashes and 3 pixel gaps once ShowHidden is set
+func NewWireframeSettings() WireframeSettings {
+	return WireframeSettings{
+		Width:      1,
+		HiddenDash: []float64{4, 3},
+	}
+}
+
+// EdgeData is an edge of a mesh in world space with the faces that share it
+type EdgeData struct {
+	Points      [2]mgl.Vec3
+	FaceNormals []mgl.Vec3  // The geometric normals of the faces that share the edge, one for open edges
+	Color       color.Color // The color of the first face with the edge
+}
+
+// EdgeObject is implemented by objects that provide the deduplicated edges of their faces for the wireframe
+type EdgeObject interface {
+	// Edges returns every edge of the faces once, in world space
+	Edges() []EdgeData
+}